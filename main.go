@@ -1,45 +1,315 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
-	"strconv"
+	"os/signal"
+	"path/filepath"
+	"sort"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/utr1903/newrelic-tracker-user/pkg/audit"
+	"github.com/utr1903/newrelic-tracker-user/pkg/config"
+	"github.com/utr1903/newrelic-tracker-user/pkg/prometheus"
+	"github.com/utr1903/newrelic-tracker-user/pkg/ratelimit"
+	"github.com/utr1903/newrelic-tracker-user/pkg/scheduler"
+	"github.com/utr1903/newrelic-tracker-user/pkg/tracker"
 	"github.com/utr1903/newrelic-tracker-user/pkg/users"
 )
 
+const (
+	EXIT_CODE_SUCCESS = 0
+	EXIT_CODE_UNKNOWN = 1
+	EXIT_CODE_CONFIG  = 2
+	EXIT_CODE_FETCH   = 3
+	EXIT_CODE_FLUSH   = 4
+	EXIT_CODE_TIMEOUT = 5
+)
+
+type runner interface {
+	Run(ctx context.Context) error
+}
+
+// trackerFactory creates a new tracker for every run since the
+// forwarders of a tracker keep the data they have flushed.
+type trackerFactory struct {
+	name     string
+	schedule config.Job
+	create   func() runner
+}
+
+type trackerResult struct {
+	name string
+	err  error
+}
+
 func main() {
-	organizationId := os.Getenv("NEWRELIC_ORGANIZATION_ID")
-	accountId, _ := strconv.ParseInt(os.Getenv("NEWRELIC_ACCOUNT_ID"), 10, 64)
-	wg := new(sync.WaitGroup)
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(EXIT_CODE_CONFIG)
+	}
+
+	if cfg.Command == config.COMMAND_EXPORT {
+		os.Exit(runExport(cfg))
+	}
+
+	factories := createTrackerFactories(cfg)
+
+	if cfg.Mode == config.MODE_DAEMON {
+		os.Exit(runDaemon(cfg, factories))
+	}
+
+	trackers := map[string]runner{}
+	for _, factory := range factories {
+		trackers[factory.name] = factory.create()
+	}
+	results := runTrackers(trackers)
+	printSummary(results)
+	os.Exit(getExitCode(results))
+}
+
+func createTrackerFactories(
+	cfg *config.Config,
+) []trackerFactory {
+	factories := make([]trackerFactory, 0)
+
+	// All trackers share the NerdGraph limits
+	limiter := ratelimit.NewLimiter(
+		cfg.RateLimit.RequestsPerSecond,
+		cfg.RateLimit.MaxInFlight,
+	)
 
 	// Users
-	wg.Add(1)
-	go authUsers(wg, organizationId)
+	factories = append(factories, trackerFactory{
+		name:     "users",
+		schedule: cfg.Schedule.Users,
+		create: func() runner {
+			return users.NewUsers(cfg, limiter)
+		},
+	})
 
 	// Audit
-	wg.Add(1)
-	go auditEvents(wg, organizationId, accountId)
+	factories = append(factories, trackerFactory{
+		name:     "audit",
+		schedule: cfg.Schedule.Audit,
+		create: func() runner {
+			return audit.NewAuditEvents(cfg, limiter)
+		},
+	})
+
+	return factories
+}
+
+// runExport writes the user inventory to the configured file or to
+// the standard output and returns the exit code. The summary is only
+// printed if it does not mix with the inventory.
+func runExport(
+	cfg *config.Config,
+) int {
+	err := export(cfg)
+	results := []trackerResult{{
+		name: "export",
+		err:  err,
+	}}
+	if err != nil || cfg.Export.Path != "" {
+		printSummary(results)
+	}
+	return getExitCode(results)
+}
+
+// export writes the inventory to the standard output or to the
+// configured file. The file is written to a temporary file first and
+// only replaces the configured one if the export has succeeded.
+func export(
+	cfg *config.Config,
+) error {
+	limiter := ratelimit.NewLimiter(
+		cfg.RateLimit.RequestsPerSecond,
+		cfg.RateLimit.MaxInFlight,
+	)
+	u := users.NewUsersExport(cfg, limiter)
 
+	if cfg.Export.Path == "" {
+		return u.Export(context.Background(), os.Stdout, cfg.Export)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(cfg.Export.Path), "."+filepath.Base(cfg.Export.Path)+".*")
+	if err != nil {
+		return tracker.Wrap(tracker.PHASE_EXPORT, err)
+	}
+	defer os.Remove(f.Name())
+
+	// The inventory holds personal data, so only the owner may read
+	// it like the files of the file output
+	err = f.Chmod(0600)
+	if err != nil {
+		f.Close()
+		return tracker.Wrap(tracker.PHASE_EXPORT, err)
+	}
+	err = u.Export(context.Background(), f, cfg.Export)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err == nil {
+		err = os.Rename(f.Name(), cfg.Export.Path)
+	}
+	if err != nil {
+		return tracker.Wrap(tracker.PHASE_EXPORT, err)
+	}
+	return nil
+}
+
+// runDaemon runs every tracker on its own schedule until SIGTERM
+// or SIGINT is received and waits for the in-flight runs to finish.
+// The Prometheus output is served for as long as the daemon runs.
+func runDaemon(
+	cfg *config.Config,
+	factories []trackerFactory,
+) int {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	if address, ok := cfg.GetPrometheusAddress(); ok {
+		server := prometheus.NewServer(address, prometheus.DefaultRegistry)
+		err := server.Start()
+		if err != nil {
+			fmt.Println(err.Error())
+			return EXIT_CODE_CONFIG
+		}
+		defer server.Shutdown(context.Background())
+		fmt.Println("prometheus metrics are served at " + server.Address() + "/metrics")
+	}
+
+	jobs := make([]scheduler.Job, 0, len(factories))
+	for _, factory := range factories {
+		create := factory.create
+		jobs = append(jobs, scheduler.Job{
+			Name:     factory.name,
+			Interval: factory.schedule.Interval.Duration(),
+			Jitter:   factory.schedule.Jitter.Duration(),
+			Run: func() error {
+				return create().Run(context.Background())
+			},
+		})
+	}
+
+	s := scheduler.NewScheduler(jobs, func(result scheduler.Result) {
+		if result.Skipped {
+			fmt.Println("tracker " + result.Name + ": skipped as previous run is still in progress")
+			return
+		}
+		printSummary([]trackerResult{{
+			name: result.Name,
+			err:  result.Err,
+		}})
+	})
+
+	fmt.Println("daemon started at " + time.Now().Format(time.RFC3339))
+	s.Start(ctx)
+	fmt.Println("daemon stopped at " + time.Now().Format(time.RFC3339))
+	return EXIT_CODE_SUCCESS
+}
+
+func runTrackers(
+	trackers map[string]runner,
+) []trackerResult {
+	wg := new(sync.WaitGroup)
+	mu := new(sync.Mutex)
+	results := make([]trackerResult, 0, len(trackers))
+
+	for name, t := range trackers {
+		wg.Add(1)
+		go func(name string, t runner) {
+			defer wg.Done()
+			err := t.Run(context.Background())
+
+			mu.Lock()
+			defer mu.Unlock()
+			results = append(results, trackerResult{
+				name: name,
+				err:  err,
+			})
+		}(name, t)
+	}
 	wg.Wait()
+
+	// Keep the summary in a stable order
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].name < results[j].name
+	})
+
+	return results
 }
 
-func authUsers(
-	wg *sync.WaitGroup,
-	organizationId string,
+func printSummary(
+	results []trackerResult,
 ) {
-	defer wg.Done()
-	us := users.NewUsers(organizationId)
-	us.Run()
+	for _, result := range results {
+		if result.err == nil {
+			fmt.Println("tracker " + result.name + ": succeeded")
+			continue
+		}
+
+		phase, ok := tracker.GetPhase(result.err)
+		if !ok {
+			phase = "unknown"
+		}
+		fmt.Println("tracker " + result.name + ": failed in phase " + string(phase) + ": " + result.err.Error())
+	}
 }
 
-func auditEvents(
-	wg *sync.WaitGroup,
-	organizationId string,
-	accountId int64,
-) {
-	defer wg.Done()
-	us := audit.NewAuditEvents(organizationId, accountId)
-	us.Run()
+// getExitCode returns the code of the most severe failure where
+// fetch failures are considered more severe than timeouts and
+// timeouts more severe than flush failures.
+func getExitCode(
+	results []trackerResult,
+) int {
+	exitCode := EXIT_CODE_SUCCESS
+	for _, result := range results {
+		if result.err == nil {
+			continue
+		}
+
+		code := EXIT_CODE_UNKNOWN
+		var timeoutErr *tracker.TimeoutError
+		if errors.As(result.err, &timeoutErr) {
+			code = EXIT_CODE_TIMEOUT
+		} else if phase, ok := tracker.GetPhase(result.err); ok {
+			switch phase {
+			case tracker.PHASE_FETCH:
+				code = EXIT_CODE_FETCH
+			case tracker.PHASE_FLUSH_METRICS, tracker.PHASE_FLUSH_EVENTS, tracker.PHASE_EXPORT:
+				code = EXIT_CODE_FLUSH
+			}
+		}
+
+		if exitCode == EXIT_CODE_SUCCESS || getSeverity(code) > getSeverity(exitCode) {
+			exitCode = code
+		}
+	}
+	return exitCode
+}
+
+func getSeverity(
+	exitCode int,
+) int {
+	switch exitCode {
+	case EXIT_CODE_FETCH:
+		return 4
+	case EXIT_CODE_TIMEOUT:
+		return 3
+	case EXIT_CODE_FLUSH:
+		return 2
+	case EXIT_CODE_UNKNOWN:
+		return 1
+	default:
+		return 0
+	}
 }
@@ -1,23 +1,48 @@
 package audit
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
-	fetch "github.com/utr1903/newrelic-tracker-internal/fetch"
-	flush "github.com/utr1903/newrelic-tracker-internal/flush"
-	graphql "github.com/utr1903/newrelic-tracker-internal/graphql"
 	logging "github.com/utr1903/newrelic-tracker-internal/logging"
-	metrics "github.com/utr1903/newrelic-tracker-internal/metrics"
+	"github.com/utr1903/newrelic-tracker-user/pkg/config"
+	"github.com/utr1903/newrelic-tracker-user/pkg/events"
+	account "github.com/utr1903/newrelic-tracker-user/pkg/graphql/account"
+	"github.com/utr1903/newrelic-tracker-user/pkg/graphql/client"
+	"github.com/utr1903/newrelic-tracker-user/pkg/graphql/gqlerror"
 	nrql "github.com/utr1903/newrelic-tracker-user/pkg/graphql/nrql"
+	"github.com/utr1903/newrelic-tracker-user/pkg/metrics"
+	"github.com/utr1903/newrelic-tracker-user/pkg/ratelimit"
+	"github.com/utr1903/newrelic-tracker-user/pkg/retry"
+	"github.com/utr1903/newrelic-tracker-user/pkg/sink"
+	"github.com/utr1903/newrelic-tracker-user/pkg/state"
+	"github.com/utr1903/newrelic-tracker-user/pkg/tracker"
+	"github.com/utr1903/newrelic-tracker-user/pkg/workerpool"
 )
 
 const (
-	AUDIT_EVENTS_GRAPHQL_HAS_RETURNED_ERRORS = "graphql has returned errors"
-	AUDIT_EVENTS_LOGS_COULD_NOT_BE_FORWARDED = "logs could not be forwarded"
+	AUDIT_EVENTS_GRAPHQL_HAS_RETURNED_ERRORS  = "graphql has returned errors"
+	AUDIT_EVENTS_LOGS_COULD_NOT_BE_FORWARDED  = "logs could not be forwarded"
+	AUDIT_EVENTS_CHECKPOINT_IS_LOADED         = "checkpoint is loaded"
+	AUDIT_EVENTS_CHECKPOINT_IS_SAVED          = "checkpoint is saved"
+	AUDIT_EVENTS_ARE_FETCHED                  = "audit events are fetched"
+	AUDIT_EVENTS_SLICE_MIGHT_BE_TRUNCATED     = "time slice cannot be split further and might be truncated"
+	AUDIT_EVENTS_ACCOUNTS_ARE_DISCOVERED      = "accounts are discovered"
+	AUDIT_EVENTS_ACCOUNT_COULD_NOT_BE_FETCHED = "audit events of account could not be fetched"
+)
+
+const (
+	// NRQL_RESULT_LIMIT is the maximum number of rows which
+	// LIMIT MAX returns for a single query.
+	NRQL_RESULT_LIMIT = 5000
+
+	// MIN_SLICE_MILLIS is the smallest time slice which is
+	// not split any further.
+	MIN_SLICE_MILLIS = 1000
 )
 
 const queryTemplate = `
@@ -33,6 +58,17 @@ const queryTemplate = `
 }
 `
 
+const queryTemplateAccounts = `
+{
+  actor {
+    accounts {
+      id
+      name
+    }
+  }
+}
+`
+
 const trackedAttributeType = "auditEvent"
 
 type queryVariables struct {
@@ -41,6 +77,7 @@ type queryVariables struct {
 }
 
 type auditEvent struct {
+	AccountId        int64  `json:"-"`
 	ActionIdentifier string `json:"actionIdentifier"`
 	ActorEmail       string `json:"actorEmail"`
 	ActorId          string `json:"actorId"`
@@ -54,129 +91,511 @@ type auditEvent struct {
 	Timestamp        int64  `json:"timestamp"`
 }
 
+// accountAuditEvents are the new audit events of an account together
+// with the checkpoint to be saved once they are flushed.
+type accountAuditEvents struct {
+	accountId   int64
+	auditEvents []auditEvent
+	checkpoint  *checkpoint
+}
+
 type AuditEvent struct {
-	AccountId       int64
-	Logger          logging.ILogger
-	Gqlc            graphql.IGraphQlClient
-	MetricForwarder metrics.IMetricForwarder
+	AccountIds       []int64
+	DiscoverAccounts bool
+	Workers          int
+	Logger           logging.ILogger
+	Gqlc             client.IGraphQlClient
+	GqlcAccounts     client.IGraphQlClient
+	Sink             sink.ISink
+	Kind             string
+	EventType        string
+	StateStore       state.IStore
+	Lookback         config.Duration
+	Timeouts         config.Timeouts
 }
 
 func NewAuditEvents(
-	organizationId string,
-	accountId int64,
+	cfg *config.Config,
+	limiter *ratelimit.Limiter,
 ) *AuditEvent {
-	logger := logging.NewLoggerWithForwarder(
-		"DEBUG",
-		os.Getenv("NEWRELIC_LICENSE_KEY"),
-		"https://log-api.eu.newrelic.com/log/v1",
-		setCommonAttributes(organizationId, accountId),
-	)
-	gqlc := graphql.NewGraphQlClient(
+	logger := tracker.NewSyncLogger(logging.NewLoggerWithForwarder(
+		cfg.LogLevel,
+		cfg.LicenseKey,
+		cfg.Endpoints.Logs,
+		setCommonAttributes(cfg.OrganizationId),
+	))
+	retrier := retry.NewRetrier(logger, retry.NewPolicy(cfg.Audit.Retry))
+	gqlc := client.NewGraphQlClient(
 		logger,
-		"https://api.eu.newrelic.com/graphql",
+		cfg.Endpoints.GraphQl,
+		cfg.ApiKey,
 		trackedAttributeType,
 		queryTemplate,
 	)
+	gqlcAccounts := client.NewGraphQlClient(
+		logger,
+		cfg.Endpoints.GraphQl,
+		cfg.ApiKey,
+		trackedAttributeType,
+		queryTemplateAccounts,
+	)
 	mf := metrics.NewMetricForwarder(
 		logger,
-		os.Getenv("NEWRELIC_LICENSE_KEY"),
-		"https://metric-api.eu.newrelic.com/metric/v1",
-		setCommonAttributes(organizationId, accountId),
+		cfg.LicenseKey,
+		cfg.Endpoints.Metrics,
+		setCommonAttributes(cfg.OrganizationId),
 	)
+	kind := sink.KIND_METRIC
+	var ef events.IEventForwarder
+	if cfg.Audit.Sink == config.SINK_EVENTS {
+		kind = sink.KIND_EVENT
+		ef = retry.NewEventForwarder(events.NewEventForwarder(
+			logger,
+			cfg.LicenseKey,
+			cfg.Endpoints.Events,
+			cfg.Audit.Events.AccountId,
+			setCommonAttributes(cfg.OrganizationId),
+			cfg.Audit.Events.MaxBatchSize,
+			cfg.Audit.Events.MaxPayloadBytes,
+		), retrier)
+	}
 	return &AuditEvent{
-		AccountId:       accountId,
-		Logger:          logger,
-		Gqlc:            gqlc,
-		MetricForwarder: mf,
+		AccountIds:       cfg.AccountIds,
+		DiscoverAccounts: cfg.Audit.DiscoverAccounts,
+		Workers:          cfg.Audit.Workers,
+		Logger:           logger,
+		Gqlc:             retry.NewGraphQlClient(ratelimit.NewGraphQlClient(gqlc, limiter), retrier),
+		GqlcAccounts:     retry.NewGraphQlClient(ratelimit.NewGraphQlClient(gqlcAccounts, limiter), retrier),
+		Sink:             sink.NewSink(cfg, sink.NewNewRelic(retry.NewMetricForwarder(mf, retrier), ef, nil)),
+		Kind:             kind,
+		EventType:        cfg.Audit.Events.EventType,
+		StateStore:       state.NewStore(cfg.StateDir),
+		Lookback:         cfg.Audit.Lookback,
+		Timeouts:         cfg.Timeouts,
 	}
 }
 
 func setCommonAttributes(
 	organizationId string,
-	accountId int64,
 ) map[string]string {
 	return map[string]string{
 		"tracker.attributeType":  trackedAttributeType,
 		"tracker.organizationId": organizationId,
-		"tracker.accountId":      strconv.FormatInt(accountId, 10),
 	}
 }
 
-func (a *AuditEvent) Run() error {
+func (a *AuditEvent) Run(
+	ctx context.Context,
+) error {
+	runTimeout := a.Timeouts.Run.Duration()
+	ctx, cancel := tracker.WithTimeout(ctx, runTimeout)
+	defer cancel()
+
+	// Fetch audit events of all accounts per GraphQL
+	var collected []*accountAuditEvents
+	var fetchErr error
+	err := tracker.RunPhase(ctx, tracker.PHASE_FETCH, a.Timeouts.Fetch.Duration(), runTimeout,
+		func(ctx context.Context) error {
+			accountIds, err := a.getAccountIds(ctx)
+			if err != nil {
+				return err
+			}
+			collected, fetchErr = a.collectAccounts(ctx, accountIds)
 
-	// Fetch audit events per GraphQL
-	auditEvents, err := a.fetchAuditEvents()
+			// An expired deadline fails the phase rather than single accounts
+			return ctx.Err()
+		})
 	if err != nil {
 		return err
 	}
 
-	// Create & flush metrics
-	err = a.flushMetrics(auditEvents)
+	// Create & flush metrics or custom events
+	auditEvents := make([]auditEvent, 0)
+	for _, c := range collected {
+		auditEvents = append(auditEvents, c.auditEvents...)
+	}
+	phase, timeout := tracker.PHASE_FLUSH_METRICS, a.Timeouts.FlushMetrics
+	if a.Kind == sink.KIND_EVENT {
+		phase, timeout = tracker.PHASE_FLUSH_EVENTS, a.Timeouts.FlushEvents
+	}
+	err = tracker.RunPhase(ctx, phase, timeout.Duration(), runTimeout,
+		func(ctx context.Context) error {
+			return a.flushRecords(ctx, auditEvents)
+		})
 	if err != nil {
 		return err
 	}
 
+	// Save the checkpoints for the next run
+	for _, c := range collected {
+		err = a.saveCheckpoint(c.accountId, c.checkpoint.advance(c.auditEvents))
+		if err != nil {
+			return tracker.Wrap(tracker.PHASE_STATE, err)
+		}
+	}
+	err = sink.Commit(a.Sink)
+	if err != nil {
+		return tracker.Wrap(phase, err)
+	}
+
 	// Flush logs
-	a.flushLogs()
+	a.flushLogs(ctx, runTimeout)
+
+	// Report the accounts which could not be fetched
+	if fetchErr != nil {
+		return tracker.Wrap(tracker.PHASE_FETCH, fetchErr)
+	}
 
 	return nil
 }
 
-func (a *AuditEvent) fetchAuditEvents() (
-	[]auditEvent,
+// getAccountIds returns the configured account IDs or discovers all
+// accounts which are accessible if none are given.
+func (a *AuditEvent) getAccountIds(
+	ctx context.Context,
+) (
+	[]int64,
 	error,
 ) {
-	qv := &queryVariables{
-		AccountId: a.AccountId,
-		NrqlQuery: "FROM NrAuditEvent SELECT * SINCE 1 day ago LIMIT MAX",
+	if !a.DiscoverAccounts && len(a.AccountIds) != 0 {
+		return a.AccountIds, nil
 	}
 
-	res := &nrql.GraphQlNrqlResponse[auditEvent]{}
-	err := fetch.Fetch(
-		a.Gqlc,
-		qv,
-		res,
+	res := &account.GraphQlAccountResponse{}
+	err := a.GqlcAccounts.Execute(ctx, struct{}{}, res)
+	if err != nil {
+		return nil, err
+	}
+	err = gqlerror.Check(a.Logger, AUDIT_EVENTS_GRAPHQL_HAS_RETURNED_ERRORS,
+		map[string]string{
+			"tracker.package": "pkg.audit",
+			"tracker.file":    "audit.go",
+		},
+		res.Errors,
+		res.Data.Actor.Accounts != nil,
 	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", AUDIT_EVENTS_GRAPHQL_HAS_RETURNED_ERRORS, err)
+	}
+
+	accountIds := make([]int64, 0, len(res.Data.Actor.Accounts))
+	for _, acc := range res.Data.Actor.Accounts {
+		accountIds = append(accountIds, acc.Id)
+	}
+
+	a.Logger.LogWithFields(logrus.DebugLevel, AUDIT_EVENTS_ACCOUNTS_ARE_DISCOVERED,
+		map[string]string{
+			"tracker.package":  "pkg.audit",
+			"tracker.file":     "audit.go",
+			"tracker.accounts": strconv.Itoa(len(accountIds)),
+		})
+	return accountIds, nil
+}
+
+// collectAccounts fetches the new audit events of every account with
+// a bounded number of workers. The accounts which are fetched are
+// returned even if others fail.
+func (a *AuditEvent) collectAccounts(
+	ctx context.Context,
+	accountIds []int64,
+) (
+	[]*accountAuditEvents,
+	error,
+) {
+	results := make([]*accountAuditEvents, len(accountIds))
+	errs := workerpool.ForEach(ctx, a.Workers, len(accountIds),
+		func(ctx context.Context, i int) error {
+			var err error
+			results[i], err = a.collectAccount(ctx, accountIds[i])
+			return err
+		})
+
+	collected := make([]*accountAuditEvents, 0, len(accountIds))
+	failed := make([]string, 0)
+	var firstErr error
+	for i, err := range errs {
+		if err != nil {
+			a.Logger.LogWithFields(logrus.ErrorLevel, AUDIT_EVENTS_ACCOUNT_COULD_NOT_BE_FETCHED,
+				map[string]string{
+					"tracker.package":   "pkg.audit",
+					"tracker.file":      "audit.go",
+					"tracker.accountId": strconv.FormatInt(accountIds[i], 10),
+					"tracker.error":     err.Error(),
+				})
+			failed = append(failed, strconv.FormatInt(accountIds[i], 10))
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		collected = append(collected, results[i])
+	}
+
+	if firstErr != nil {
+		return collected, fmt.Errorf("%s [%s]: %w", AUDIT_EVENTS_ACCOUNT_COULD_NOT_BE_FETCHED, strings.Join(failed, ","), firstErr)
+	}
+	return collected, nil
+}
+
+func (a *AuditEvent) collectAccount(
+	ctx context.Context,
+	accountId int64,
+) (
+	*accountAuditEvents,
+	error,
+) {
+	// Load the checkpoint of the previous run
+	cp, err := a.loadCheckpoint(accountId)
 	if err != nil {
 		return nil, err
 	}
-	if res.Errors != nil {
-		a.Logger.LogWithFields(logrus.DebugLevel, AUDIT_EVENTS_GRAPHQL_HAS_RETURNED_ERRORS,
+
+	since, until := a.getWindow(cp)
+	auditEvents, err := a.fetchAuditEvents(ctx, accountId, since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop the events which are flushed already
+	if cp != nil {
+		auditEvents = cp.filter(auditEvents)
+	} else {
+		cp = &checkpoint{}
+	}
+
+	return &accountAuditEvents{
+		accountId:   accountId,
+		auditEvents: auditEvents,
+		checkpoint:  cp,
+	}, nil
+}
+
+func (a *AuditEvent) loadCheckpoint(
+	accountId int64,
+) (
+	*checkpoint,
+	error,
+) {
+	if a.StateStore == nil {
+		return nil, nil
+	}
+
+	cp := &checkpoint{}
+	ok, err := a.StateStore.Load(getCheckpointName(accountId), cp)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	a.Logger.LogWithFields(logrus.DebugLevel, AUDIT_EVENTS_CHECKPOINT_IS_LOADED,
+		map[string]string{
+			"tracker.package":   "pkg.audit",
+			"tracker.file":      "audit.go",
+			"tracker.accountId": strconv.FormatInt(accountId, 10),
+			"tracker.timestamp": strconv.FormatInt(cp.Timestamp, 10),
+		})
+	return cp, nil
+}
+
+func (a *AuditEvent) saveCheckpoint(
+	accountId int64,
+	cp *checkpoint,
+) error {
+	if a.StateStore == nil || cp.Timestamp == 0 {
+		return nil
+	}
+
+	err := a.StateStore.Save(getCheckpointName(accountId), cp)
+	if err != nil {
+		return err
+	}
+
+	a.Logger.LogWithFields(logrus.DebugLevel, AUDIT_EVENTS_CHECKPOINT_IS_SAVED,
+		map[string]string{
+			"tracker.package":   "pkg.audit",
+			"tracker.file":      "audit.go",
+			"tracker.accountId": strconv.FormatInt(accountId, 10),
+			"tracker.timestamp": strconv.FormatInt(cp.Timestamp, 10),
+		})
+	return nil
+}
+
+// getWindow returns the query window in epoch milliseconds. It starts
+// at the checkpoint or, if there is none, at the configured lookback.
+func (a *AuditEvent) getWindow(
+	cp *checkpoint,
+) (
+	int64,
+	int64,
+) {
+	now := time.Now()
+	until := now.UnixMilli()
+	if cp != nil {
+		return cp.Timestamp, until
+	}
+	return now.Add(-a.Lookback.Duration()).UnixMilli(), until
+}
+
+// fetchAuditEvents fetches all audit events within the given window.
+// Windows which hit the NRQL result limit are split into halves
+// until every slice returns less events than the limit.
+func (a *AuditEvent) fetchAuditEvents(
+	ctx context.Context,
+	accountId int64,
+	since int64,
+	until int64,
+) (
+	[]auditEvent,
+	error,
+) {
+	slices := 0
+	auditEvents, err := a.fetchAuditEventsInSlice(ctx, accountId, since, until, &slices)
+	if err != nil {
+		return nil, err
+	}
+
+	// Slices might overlap at their boundaries
+	auditEvents = deduplicate(auditEvents)
+
+	a.Logger.LogWithFields(logrus.DebugLevel, AUDIT_EVENTS_ARE_FETCHED,
+		map[string]string{
+			"tracker.package":   "pkg.audit",
+			"tracker.file":      "audit.go",
+			"tracker.accountId": strconv.FormatInt(accountId, 10),
+			"tracker.slices":    strconv.Itoa(slices),
+			"tracker.events":    strconv.Itoa(len(auditEvents)),
+		})
+	return auditEvents, nil
+}
+
+func (a *AuditEvent) fetchAuditEventsInSlice(
+	ctx context.Context,
+	accountId int64,
+	since int64,
+	until int64,
+	slices *int,
+) (
+	[]auditEvent,
+	error,
+) {
+	auditEvents, err := a.queryAuditEvents(ctx, accountId, since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	// Return if the slice is complete
+	if len(auditEvents) < NRQL_RESULT_LIMIT {
+		*slices++
+		return auditEvents, nil
+	}
+
+	// Return what is there if the slice cannot be split anymore
+	if until-since <= MIN_SLICE_MILLIS {
+		*slices++
+		a.Logger.LogWithFields(logrus.ErrorLevel, AUDIT_EVENTS_SLICE_MIGHT_BE_TRUNCATED,
 			map[string]string{
-				"tracker.package": "pkg.audit",
-				"tracker.file":    "audit.go",
-				"tracker.error":   fmt.Sprintf("%v", res.Errors),
+				"tracker.package":   "pkg.audit",
+				"tracker.file":      "audit.go",
+				"tracker.accountId": strconv.FormatInt(accountId, 10),
+				"tracker.since":     strconv.FormatInt(since, 10),
+				"tracker.until":     strconv.FormatInt(until, 10),
 			})
-		return nil, errors.New(AUDIT_EVENTS_GRAPHQL_HAS_RETURNED_ERRORS)
+		return auditEvents, nil
+	}
+
+	// Split the slice into halves
+	middle := since + (until-since)/2
+	first, err := a.fetchAuditEventsInSlice(ctx, accountId, since, middle, slices)
+	if err != nil {
+		return nil, err
+	}
+	second, err := a.fetchAuditEventsInSlice(ctx, accountId, middle, until, slices)
+	if err != nil {
+		return nil, err
+	}
+	return append(first, second...), nil
+}
+
+func deduplicate(
+	auditEvents []auditEvent,
+) []auditEvent {
+	seen := make(map[string]struct{}, len(auditEvents))
+	deduplicated := make([]auditEvent, 0, len(auditEvents))
+	for _, auditEvent := range auditEvents {
+		if _, ok := seen[auditEvent.Id]; ok {
+			continue
+		}
+		seen[auditEvent.Id] = struct{}{}
+		deduplicated = append(deduplicated, auditEvent)
+	}
+	return deduplicated
+}
+
+func (a *AuditEvent) queryAuditEvents(
+	ctx context.Context,
+	accountId int64,
+	since int64,
+	until int64,
+) (
+	[]auditEvent,
+	error,
+) {
+	qv := &queryVariables{
+		AccountId: accountId,
+		NrqlQuery: fmt.Sprintf("FROM NrAuditEvent SELECT * SINCE %d UNTIL %d LIMIT MAX", since, until),
 	}
 
-	return res.Data.Actor.Nrql.Results, nil
+	res := &nrql.GraphQlNrqlResponse[auditEvent]{}
+	err := a.Gqlc.Execute(ctx, qv, res)
+	if err != nil {
+		return nil, err
+	}
+	err = gqlerror.Check(a.Logger, AUDIT_EVENTS_GRAPHQL_HAS_RETURNED_ERRORS,
+		map[string]string{
+			"tracker.package":   "pkg.audit",
+			"tracker.file":      "audit.go",
+			"tracker.accountId": strconv.FormatInt(accountId, 10),
+		},
+		res.Errors,
+		res.Data.Actor.Nrql.Results != nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", AUDIT_EVENTS_GRAPHQL_HAS_RETURNED_ERRORS, err)
+	}
+
+	auditEvents := res.Data.Actor.Nrql.Results
+	for i := range auditEvents {
+		auditEvents[i].AccountId = accountId
+	}
+	return auditEvents, nil
 }
 
-func (a *AuditEvent) flushMetrics(
+// flushRecords writes every audit event as a metric or as a custom
+// event which keeps the high cardinality attributes out of the
+// metrics.
+func (a *AuditEvent) flushRecords(
+	ctx context.Context,
 	auditEvents []auditEvent,
 ) error {
-	metrics := []flush.FlushMetric{}
+	records := make([]sink.Record, 0, len(auditEvents))
 	for _, auditEvent := range auditEvents {
-		metrics = append(metrics, flush.FlushMetric{
-			Name:      "tracker.users.audit.value",
-			Value:     1.0,
-			Timestamp: auditEvent.Timestamp,
-			Attributes: map[string]string{
-				"tracker.users.audit.actionIdentifier": auditEvent.ActionIdentifier,
-				"tracker.users.audit.actorEmail":       auditEvent.ActorEmail,
-				"tracker.users.audit.actorId":          auditEvent.ActorId,
-				"tracker.users.audit.actorType":        auditEvent.ActorType,
-				"tracker.users.audit.description":      auditEvent.Description,
-				"tracker.users.audit.id":               auditEvent.Id,
-				"tracker.users.audit.scopeId":          auditEvent.ScopeId,
-				"tracker.users.audit.scopeType":        auditEvent.ScopeType,
-				"tracker.users.audit.targetId":         auditEvent.TargetId,
-				"tracker.users.audit.targetType":       auditEvent.TargetType,
-			},
-		})
+		record := sink.Record{
+			Kind:       sink.KIND_METRIC,
+			Name:       "tracker.users.audit.value",
+			Value:      1.0,
+			Timestamp:  auditEvent.Timestamp,
+			Attributes: auditEvent.attributes(),
+		}
+		if a.Kind == sink.KIND_EVENT {
+			record.Kind = sink.KIND_EVENT
+			record.Name = a.EventType
+			record.Value = 0
+		}
+		records = append(records, record)
 	}
-	err := flush.Flush(a.MetricForwarder, metrics)
+	err := a.Sink.Write(ctx, records)
 	if err != nil {
 		return err
 	}
@@ -184,8 +603,32 @@ func (a *AuditEvent) flushMetrics(
 	return nil
 }
 
-func (a *AuditEvent) flushLogs() {
-	err := a.Logger.Flush()
+func (e *auditEvent) attributes() map[string]string {
+	return map[string]string{
+		// Kept for the queries from when a tracker had a single account
+		"tracker.accountId":                    strconv.FormatInt(e.AccountId, 10),
+		"tracker.users.audit.accountId":        strconv.FormatInt(e.AccountId, 10),
+		"tracker.users.audit.actionIdentifier": e.ActionIdentifier,
+		"tracker.users.audit.actorEmail":       e.ActorEmail,
+		"tracker.users.audit.actorId":          e.ActorId,
+		"tracker.users.audit.actorType":        e.ActorType,
+		"tracker.users.audit.description":      e.Description,
+		"tracker.users.audit.id":               e.Id,
+		"tracker.users.audit.scopeId":          e.ScopeId,
+		"tracker.users.audit.scopeType":        e.ScopeType,
+		"tracker.users.audit.targetId":         e.TargetId,
+		"tracker.users.audit.targetType":       e.TargetType,
+	}
+}
+
+func (a *AuditEvent) flushLogs(
+	ctx context.Context,
+	runTimeout time.Duration,
+) {
+	err := tracker.RunPhase(ctx, tracker.PHASE_FLUSH_LOGS, a.Timeouts.FlushLogs.Duration(), runTimeout,
+		func(ctx context.Context) error {
+			return tracker.Await(ctx, a.Logger.Flush)
+		})
 	if err != nil {
 		fmt.Println(AUDIT_EVENTS_LOGS_COULD_NOT_BE_FORWARDED, err.Error())
 	}
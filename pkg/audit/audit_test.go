@@ -0,0 +1,533 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/utr1903/newrelic-tracker-user/pkg/config"
+	account "github.com/utr1903/newrelic-tracker-user/pkg/graphql/account"
+	nrql "github.com/utr1903/newrelic-tracker-user/pkg/graphql/nrql"
+	"github.com/utr1903/newrelic-tracker-user/pkg/prometheus"
+	"github.com/utr1903/newrelic-tracker-user/pkg/sink"
+	"github.com/utr1903/newrelic-tracker-user/pkg/tracker"
+)
+
+const accountId = int64(12345)
+
+var errFetchAuditEvents = errors.New("error_fetch_audit_events")
+
+var base = time.Now().Add(-time.Hour).UnixMilli()
+
+type loggerMock struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func newLoggerMock() *loggerMock {
+	return &loggerMock{
+		msgs: make([]string, 0),
+	}
+}
+
+func (l *loggerMock) LogWithFields(
+	lvl logrus.Level,
+	msg string,
+	attributes map[string]string,
+) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, msg)
+}
+
+func (l *loggerMock) Flush() error {
+	return nil
+}
+
+type graphqlClientMock struct {
+	mu             sync.Mutex
+	failRequest    bool
+	failAccountIds []int64
+	delay          time.Duration
+	auditEvents    []auditEvent
+	queries        []string
+}
+
+func (c *graphqlClientMock) Execute(
+	ctx context.Context,
+	qv any,
+	result any,
+) error {
+	select {
+	case <-time.After(c.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if c.failRequest {
+		return errFetchAuditEvents
+	}
+
+	qvParsed := qv.(*queryVariables)
+	for _, failAccountId := range c.failAccountIds {
+		if qvParsed.AccountId == failAccountId {
+			return errFetchAuditEvents
+		}
+	}
+
+	query := qvParsed.NrqlQuery
+	c.mu.Lock()
+	c.queries = append(c.queries, query)
+	c.mu.Unlock()
+
+	// Return the events of the queried window up to the limit
+	var since, until int64
+	fmt.Sscanf(query, "FROM NrAuditEvent SELECT * SINCE %d UNTIL %d LIMIT MAX", &since, &until)
+	results := make([]auditEvent, 0)
+	for _, auditEvent := range c.auditEvents {
+		if auditEvent.Timestamp >= since && auditEvent.Timestamp < until && len(results) < NRQL_RESULT_LIMIT {
+			results = append(results, auditEvent)
+		}
+	}
+
+	res := nrql.GraphQlNrqlResponse[auditEvent]{
+		Data: nrql.Data[auditEvent]{
+			Actor: nrql.Actor[auditEvent]{
+				Nrql: nrql.Nrql[auditEvent]{
+					Results: results,
+				},
+			},
+		},
+	}
+
+	bytes, err := json.Marshal(res)
+	if err != nil {
+		panic(err)
+	}
+
+	err = json.Unmarshal(bytes, result)
+	if err != nil {
+		panic(err)
+	}
+
+	return nil
+}
+
+type graphqlClientMockAccounts struct {
+	accountIds []int64
+}
+
+func (c *graphqlClientMockAccounts) Execute(
+	ctx context.Context,
+	qv any,
+	result any,
+) error {
+	res := account.GraphQlAccountResponse{}
+	for _, accountId := range c.accountIds {
+		res.Data.Actor.Accounts = append(res.Data.Actor.Accounts, account.Account{
+			Id: accountId,
+		})
+	}
+
+	bytes, err := json.Marshal(res)
+	if err != nil {
+		panic(err)
+	}
+
+	err = json.Unmarshal(bytes, result)
+	if err != nil {
+		panic(err)
+	}
+
+	return nil
+}
+
+type metricForwarderMock struct {
+	returnError bool
+	metrics     []map[string]string
+}
+
+func (mf *metricForwarderMock) AddMetric(
+	metricTimestamp int64,
+	metricName string,
+	metricType string,
+	metricValue float64,
+	metricAttributes map[string]string,
+) {
+	mf.metrics = append(mf.metrics, metricAttributes)
+}
+
+func (mf *metricForwarderMock) Run(
+	ctx context.Context,
+) error {
+	if mf.returnError {
+		return errors.New("error_flush_metrics")
+	}
+	return nil
+}
+
+type eventForwarderMock struct {
+	eventTypes []string
+	events     []map[string]string
+}
+
+func (ef *eventForwarderMock) AddEvent(
+	eventType string,
+	timestamp int64,
+	attributes map[string]string,
+) {
+	ef.eventTypes = append(ef.eventTypes, eventType)
+	ef.events = append(ef.events, attributes)
+}
+
+func (ef *eventForwarderMock) Run(
+	ctx context.Context,
+) error {
+	return nil
+}
+
+type stateStoreMock struct {
+	states map[string][]byte
+}
+
+func newStateStoreMock() *stateStoreMock {
+	return &stateStoreMock{
+		states: map[string][]byte{},
+	}
+}
+
+func (s *stateStoreMock) Load(
+	name string,
+	value any,
+) (
+	bool,
+	error,
+) {
+	bytes, ok := s.states[name]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(bytes, value)
+}
+
+func (s *stateStoreMock) Save(
+	name string,
+	value any,
+) error {
+	bytes, err := json.Marshal(value)
+	s.states[name] = bytes
+	return err
+}
+
+func createAuditEventsMock() []auditEvent {
+	return []auditEvent{
+		{Id: "a", Timestamp: base},
+		{Id: "b", Timestamp: base + 1000},
+		{Id: "c", Timestamp: base + 1000},
+		{Id: "d", Timestamp: base + 2000},
+	}
+}
+
+func Test_FetchingAuditEventsFails(t *testing.T) {
+	ae := &AuditEvent{
+		AccountIds: []int64{accountId},
+		Logger:     newLoggerMock(),
+		Gqlc: &graphqlClientMock{
+			failRequest: true,
+		},
+		Sink:       sink.NewNewRelic(&metricForwarderMock{}, nil, nil),
+		StateStore: newStateStoreMock(),
+	}
+
+	err := ae.Run(context.Background())
+
+	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, errFetchAuditEvents))
+}
+
+func Test_FetchingTimesOut(t *testing.T) {
+	store := newStateStoreMock()
+	ae := &AuditEvent{
+		AccountIds: []int64{accountId},
+		Logger:     newLoggerMock(),
+		Gqlc: &graphqlClientMock{
+			delay:       100 * time.Millisecond,
+			auditEvents: createAuditEventsMock(),
+		},
+		Sink:       sink.NewNewRelic(&metricForwarderMock{}, nil, nil),
+		StateStore: store,
+		Lookback:   config.Duration(2 * time.Hour),
+		Timeouts: config.Timeouts{
+			Fetch: config.Duration(10 * time.Millisecond),
+		},
+	}
+
+	err := ae.Run(context.Background())
+
+	var timeoutErr *tracker.TimeoutError
+	assert.True(t, errors.As(err, &timeoutErr))
+	assert.Equal(t, tracker.PHASE_FETCH, timeoutErr.Phase)
+
+	phase, _ := tracker.GetPhase(err)
+	assert.Equal(t, tracker.PHASE_FETCH, phase)
+	assert.Empty(t, store.states)
+}
+
+func Test_FlushingFailsAndCheckpointIsNotSaved(t *testing.T) {
+	store := newStateStoreMock()
+	ae := &AuditEvent{
+		AccountIds: []int64{accountId},
+		Logger:     newLoggerMock(),
+		Gqlc: &graphqlClientMock{
+			auditEvents: createAuditEventsMock(),
+		},
+		Sink:       sink.NewNewRelic(&metricForwarderMock{returnError: true}, nil, nil),
+		StateStore: store,
+		Lookback:   config.Duration(2 * time.Hour),
+	}
+
+	err := ae.Run(context.Background())
+
+	assert.NotNil(t, err)
+	assert.Equal(t, "error_flush_metrics", err.Error())
+	assert.Empty(t, store.states)
+}
+
+func Test_PrometheusCountsEventsOfFailedFlushOnce(t *testing.T) {
+	store := newStateStoreMock()
+	registry := prometheus.NewRegistry()
+	gqlc := &graphqlClientMock{
+		auditEvents: createAuditEventsMock(),
+	}
+	run := func(mf *metricForwarderMock) error {
+		ae := &AuditEvent{
+			AccountIds: []int64{accountId},
+			Logger:     newLoggerMock(),
+			Gqlc:       gqlc,
+			Sink:       sink.NewMulti(sink.NewNewRelic(mf, nil, nil), sink.NewPrometheus(registry, "")),
+			StateStore: store,
+			Lookback:   config.Duration(2 * time.Hour),
+		}
+		return ae.Run(context.Background())
+	}
+
+	err := run(&metricForwarderMock{returnError: true})
+	assert.NotNil(t, err)
+	err = run(&metricForwarderMock{})
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	registry.Write(&buf)
+	assert.Contains(t, buf.String(), `newrelic_tracker_users_audit_events_total{action_identifier="",actor_type=""} 4`)
+}
+
+func Test_FirstRunFlushesAllEvents(t *testing.T) {
+	store := newStateStoreMock()
+	mf := &metricForwarderMock{}
+	ae := &AuditEvent{
+		AccountIds: []int64{accountId},
+		Logger:     newLoggerMock(),
+		Gqlc: &graphqlClientMock{
+			auditEvents: createAuditEventsMock(),
+		},
+		Sink:       sink.NewNewRelic(mf, nil, nil),
+		StateStore: store,
+		Lookback:   config.Duration(2 * time.Hour),
+	}
+
+	err := ae.Run(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(mf.metrics))
+	assert.Equal(t, strconv.FormatInt(accountId, 10), mf.metrics[0]["tracker.accountId"])
+
+	cp := &checkpoint{}
+	ok, _ := store.Load(getCheckpointName(accountId), cp)
+	assert.True(t, ok)
+	assert.Equal(t, base+2000, cp.Timestamp)
+	assert.Equal(t, []string{"d"}, cp.EventIds)
+}
+
+func Test_CheckpointFiltersFlushedEvents(t *testing.T) {
+	store := newStateStoreMock()
+	store.Save(getCheckpointName(accountId), &checkpoint{
+		Timestamp: base + 1000,
+		EventIds:  []string{"b"},
+	})
+
+	gqlc := &graphqlClientMock{
+		auditEvents: createAuditEventsMock(),
+	}
+	mf := &metricForwarderMock{}
+	ae := &AuditEvent{
+		AccountIds: []int64{accountId},
+		Logger:     newLoggerMock(),
+		Gqlc:       gqlc,
+		Sink:       sink.NewNewRelic(mf, nil, nil),
+		StateStore: store,
+	}
+
+	err := ae.Run(context.Background())
+
+	assert.Nil(t, err)
+	assert.Contains(t, gqlc.queries[0], "SINCE "+strconv.FormatInt(base+1000, 10)+" UNTIL")
+	assert.Equal(t, 2, len(mf.metrics))
+	assert.Equal(t, "c", mf.metrics[0]["tracker.users.audit.id"])
+	assert.Equal(t, "d", mf.metrics[1]["tracker.users.audit.id"])
+}
+
+func Test_CheckpointKeepsIdsOfSameTimestamp(t *testing.T) {
+	cp := &checkpoint{
+		Timestamp: 3000,
+		EventIds:  []string{"x"},
+	}
+
+	next := cp.advance([]auditEvent{
+		{Id: "y", Timestamp: 3000},
+	})
+
+	assert.Equal(t, int64(3000), next.Timestamp)
+	assert.Equal(t, []string{"x", "y"}, next.EventIds)
+	assert.Equal(t, []string{"x"}, cp.EventIds)
+}
+
+func Test_WindowHittingTheLimitIsSliced(t *testing.T) {
+	now := time.Now().UnixMilli()
+	auditEvents := make([]auditEvent, 0)
+	for i := 0; i < 3*NRQL_RESULT_LIMIT; i++ {
+		auditEvents = append(auditEvents, auditEvent{
+			Id:        strconv.Itoa(i),
+			Timestamp: now - int64(i*10),
+		})
+	}
+
+	gqlc := &graphqlClientMock{
+		auditEvents: auditEvents,
+	}
+	logger := newLoggerMock()
+	ae := &AuditEvent{
+		AccountIds: []int64{accountId},
+		Logger:     logger,
+		Gqlc:       gqlc,
+		Sink:       sink.NewNewRelic(&metricForwarderMock{}, nil, nil),
+	}
+
+	fetched, err := ae.fetchAuditEvents(context.Background(), accountId, now-int64(time.Hour/time.Millisecond), now+1)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3*NRQL_RESULT_LIMIT, len(fetched))
+	assert.Greater(t, len(gqlc.queries), 3)
+	assert.Contains(t, logger.msgs, AUDIT_EVENTS_ARE_FETCHED)
+}
+
+func Test_UnsplittableSliceIsReported(t *testing.T) {
+	auditEvents := make([]auditEvent, 0)
+	for i := 0; i < NRQL_RESULT_LIMIT+1; i++ {
+		auditEvents = append(auditEvents, auditEvent{
+			Id:        strconv.Itoa(i),
+			Timestamp: 1000,
+		})
+	}
+
+	logger := newLoggerMock()
+	ae := &AuditEvent{
+		AccountIds: []int64{accountId},
+		Logger:     logger,
+		Gqlc: &graphqlClientMock{
+			auditEvents: auditEvents,
+		},
+		Sink: sink.NewNewRelic(&metricForwarderMock{}, nil, nil),
+	}
+
+	fetched, err := ae.fetchAuditEvents(context.Background(), accountId, 0, 10000)
+
+	assert.Nil(t, err)
+	assert.Equal(t, NRQL_RESULT_LIMIT, len(fetched))
+	assert.Contains(t, logger.msgs, AUDIT_EVENTS_SLICE_MIGHT_BE_TRUNCATED)
+}
+
+func Test_DiscoveredAccountsAreFetched(t *testing.T) {
+	store := newStateStoreMock()
+	mf := &metricForwarderMock{}
+	ae := &AuditEvent{
+		DiscoverAccounts: true,
+		Workers:          2,
+		Logger:           newLoggerMock(),
+		Gqlc: &graphqlClientMock{
+			auditEvents: createAuditEventsMock(),
+		},
+		GqlcAccounts: &graphqlClientMockAccounts{
+			accountIds: []int64{1, 2, 3},
+		},
+		Sink:       sink.NewNewRelic(mf, nil, nil),
+		StateStore: store,
+		Lookback:   config.Duration(2 * time.Hour),
+	}
+
+	err := ae.Run(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 12, len(mf.metrics))
+	assert.Equal(t, "1", mf.metrics[0]["tracker.users.audit.accountId"])
+	assert.Equal(t, "3", mf.metrics[11]["tracker.users.audit.accountId"])
+	assert.Equal(t, 3, len(store.states))
+}
+
+func Test_FailingAccountDoesNotBlockOthers(t *testing.T) {
+	store := newStateStoreMock()
+	mf := &metricForwarderMock{}
+	ae := &AuditEvent{
+		AccountIds: []int64{1, 2},
+		Workers:    2,
+		Logger:     newLoggerMock(),
+		Gqlc: &graphqlClientMock{
+			failAccountIds: []int64{2},
+			auditEvents:    createAuditEventsMock(),
+		},
+		Sink:       sink.NewNewRelic(mf, nil, nil),
+		StateStore: store,
+		Lookback:   config.Duration(2 * time.Hour),
+	}
+
+	err := ae.Run(context.Background())
+
+	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, errFetchAuditEvents))
+	assert.Equal(t, 4, len(mf.metrics))
+	assert.Equal(t, 1, len(store.states))
+	_, ok := store.states[getCheckpointName(1)]
+	assert.True(t, ok)
+}
+
+func Test_EventSinkWritesCustomEvents(t *testing.T) {
+	mf := &metricForwarderMock{}
+	ef := &eventForwarderMock{}
+	ae := &AuditEvent{
+		AccountIds: []int64{accountId},
+		Logger:     newLoggerMock(),
+		Gqlc: &graphqlClientMock{
+			auditEvents: createAuditEventsMock(),
+		},
+		Sink:       sink.NewNewRelic(mf, ef, nil),
+		Kind:       sink.KIND_EVENT,
+		EventType:  "UserAuditEvent",
+		StateStore: newStateStoreMock(),
+		Lookback:   config.Duration(2 * time.Hour),
+	}
+
+	err := ae.Run(context.Background())
+
+	assert.Nil(t, err)
+	assert.Empty(t, mf.metrics)
+	assert.Equal(t, 4, len(ef.events))
+	assert.Equal(t, "UserAuditEvent", ef.eventTypes[0])
+	assert.Equal(t, "a", ef.events[0]["tracker.users.audit.id"])
+}
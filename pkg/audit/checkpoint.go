@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"strconv"
+)
+
+// checkpoint is the high-water mark of the audit events which are
+// already flushed. Since NRQL windows are inclusive, the IDs of the
+// events at the last timestamp are kept to filter them out.
+type checkpoint struct {
+	Timestamp int64    `json:"timestamp"`
+	EventIds  []string `json:"eventIds"`
+}
+
+func getCheckpointName(
+	accountId int64,
+) string {
+	return "audit-" + strconv.FormatInt(accountId, 10)
+}
+
+// filter drops the events which are already covered by the checkpoint.
+func (c *checkpoint) filter(
+	auditEvents []auditEvent,
+) []auditEvent {
+	seen := make(map[string]struct{}, len(c.EventIds))
+	for _, id := range c.EventIds {
+		seen[id] = struct{}{}
+	}
+
+	filtered := make([]auditEvent, 0, len(auditEvents))
+	for _, auditEvent := range auditEvents {
+		if auditEvent.Timestamp < c.Timestamp {
+			continue
+		}
+		if auditEvent.Timestamp == c.Timestamp {
+			if _, ok := seen[auditEvent.Id]; ok {
+				continue
+			}
+		}
+		filtered = append(filtered, auditEvent)
+	}
+	return filtered
+}
+
+// advance returns the checkpoint after the given events are flushed.
+func (c *checkpoint) advance(
+	auditEvents []auditEvent,
+) *checkpoint {
+	next := &checkpoint{
+		Timestamp: c.Timestamp,
+		EventIds:  append([]string{}, c.EventIds...),
+	}
+
+	for _, auditEvent := range auditEvents {
+		if auditEvent.Timestamp > next.Timestamp {
+			next.Timestamp = auditEvent.Timestamp
+			next.EventIds = []string{}
+		}
+		if auditEvent.Timestamp == next.Timestamp {
+			next.EventIds = append(next.EventIds, auditEvent.Id)
+		}
+	}
+	return next
+}
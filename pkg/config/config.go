@@ -0,0 +1,870 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/utr1903/newrelic-tracker-user/pkg/redact"
+	"github.com/utr1903/newrelic-tracker-user/pkg/region"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	CONFIG_FILE_COULD_NOT_BE_READ            = "config file could not be read"
+	CONFIG_FILE_COULD_NOT_BE_PARSED          = "config file could not be parsed"
+	CONFIG_FILE_FORMAT_IS_NOT_SUPPORTED      = "config file format is not supported"
+	CONFIG_FLAGS_COULD_NOT_BE_PARSED         = "flags could not be parsed"
+	CONFIG_ACCOUNT_ID_IS_INVALID             = "account ID is invalid"
+	CONFIG_ORGANIZATION_ID_IS_MISSING        = "organization ID is missing"
+	CONFIG_ACCOUNT_IDS_ARE_MISSING           = "account IDs are missing"
+	CONFIG_LICENSE_KEY_IS_MISSING            = "license key is missing"
+	CONFIG_API_KEY_IS_MISSING                = "API key is missing"
+	CONFIG_LOG_LEVEL_IS_INVALID              = "log level is invalid"
+	CONFIG_CONFIGURATION_IS_INVALID          = "configuration is invalid"
+	CONFIG_ENDPOINTS_COULD_NOT_BE_RESOLVED   = "endpoints could not be resolved"
+	CONFIG_ENVIRONMENT_VARIABLE_IS_MALFORMED = "environment variable is malformed"
+	CONFIG_MODE_IS_INVALID                   = "mode is invalid"
+	CONFIG_INTERVAL_IS_INVALID               = "interval is invalid"
+	CONFIG_JITTER_IS_INVALID                 = "jitter is invalid"
+	CONFIG_TIMEOUT_IS_INVALID                = "timeout is invalid"
+	CONFIG_STATE_DIR_IS_MISSING              = "state directory is missing"
+	CONFIG_LOOKBACK_IS_INVALID               = "lookback is invalid"
+	CONFIG_WORKERS_ARE_INVALID               = "number of workers is invalid"
+	CONFIG_MAX_PAGES_ARE_INVALID             = "max pages are invalid"
+	CONFIG_RETRY_IS_INVALID                  = "retry is invalid"
+	CONFIG_RATE_LIMIT_IS_INVALID             = "rate limit is invalid"
+	CONFIG_INACTIVITY_IS_INVALID             = "inactivity thresholds are invalid"
+	CONFIG_REDACTION_IS_INVALID              = "redaction is invalid"
+	CONFIG_SINK_IS_INVALID                   = "sink is invalid"
+	CONFIG_EVENTS_ARE_INVALID                = "events are invalid"
+	CONFIG_OUTPUTS_ARE_INVALID               = "outputs are invalid"
+	CONFIG_EXPORT_IS_INVALID                 = "export is invalid"
+)
+
+const (
+	LOG_LEVEL_DEBUG = "DEBUG"
+	LOG_LEVEL_ERROR = "ERROR"
+)
+
+const (
+	MODE_ONCE   = "once"
+	MODE_DAEMON = "daemon"
+)
+
+const (
+	SINK_METRICS = "metrics"
+	SINK_EVENTS  = "events"
+)
+
+// COMMAND_EXPORT writes the user inventory instead of running the
+// trackers.
+const COMMAND_EXPORT = "export"
+
+const (
+	EXPORT_COLUMN_DOMAIN_NAME        = "domainName"
+	EXPORT_COLUMN_USER_ID            = "userId"
+	EXPORT_COLUMN_NAME               = "name"
+	EXPORT_COLUMN_EMAIL              = "email"
+	EXPORT_COLUMN_TYPE               = "type"
+	EXPORT_COLUMN_VERIFICATION_STATE = "verificationState"
+	EXPORT_COLUMN_LAST_ACTIVE        = "lastActive"
+	EXPORT_COLUMN_TIME_ZONE          = "timeZone"
+)
+
+// ExportColumns are all columns of the export in their default
+// order.
+var ExportColumns = []string{
+	EXPORT_COLUMN_DOMAIN_NAME,
+	EXPORT_COLUMN_USER_ID,
+	EXPORT_COLUMN_NAME,
+	EXPORT_COLUMN_EMAIL,
+	EXPORT_COLUMN_TYPE,
+	EXPORT_COLUMN_VERIFICATION_STATE,
+	EXPORT_COLUMN_LAST_ACTIVE,
+	EXPORT_COLUMN_TIME_ZONE,
+}
+
+const (
+	OUTPUT_NEW_RELIC  = "newrelic"
+	OUTPUT_STDOUT     = "stdout"
+	OUTPUT_FILE       = "file"
+	OUTPUT_PROMETHEUS = "prometheus"
+)
+
+// DEFAULT_PROMETHEUS_ADDRESS is the address of the Prometheus
+// output if none is given.
+const DEFAULT_PROMETHEUS_ADDRESS = ":9464"
+
+// Config is the configuration of the trackers. The values are
+// loaded in the following order where the latter overrides the
+// former: defaults, config file, environment variables, flags.
+type Config struct {
+	Command        string           `json:"-" yaml:"-"`
+	OrganizationId string           `json:"organizationId" yaml:"organizationId"`
+	AccountIds     []int64          `json:"accountIds" yaml:"accountIds"`
+	LicenseKey     string           `json:"licenseKey" yaml:"licenseKey"`
+	ApiKey         string           `json:"apiKey" yaml:"apiKey"`
+	LogLevel       string           `json:"logLevel" yaml:"logLevel"`
+	Region         string           `json:"region" yaml:"region"`
+	Endpoints      region.Endpoints `json:"endpoints" yaml:"endpoints"`
+	Mode           string           `json:"mode" yaml:"mode"`
+	Schedule       Schedule         `json:"schedule" yaml:"schedule"`
+	Timeouts       Timeouts         `json:"timeouts" yaml:"timeouts"`
+	StateDir       string           `json:"stateDir" yaml:"stateDir"`
+	RateLimit      RateLimit        `json:"rateLimit" yaml:"rateLimit"`
+	Redaction      Redaction        `json:"redaction" yaml:"redaction"`
+	Outputs        []Output         `json:"outputs" yaml:"outputs"`
+	Export         Export           `json:"export" yaml:"export"`
+	Users          Users            `json:"users" yaml:"users"`
+	Audit          Audit            `json:"audit" yaml:"audit"`
+
+	redactor *redact.Redactor
+}
+
+// Users is the configuration of the users tracker. The workers
+// are the number of authentication domains fetched in parallel and
+// the max pages limit how many pages are fetched per connection.
+// Collecting the access is opt-in since it fetches the groups and
+// roles of the users which requires authorization management access.
+type Users struct {
+	Workers       int        `json:"workers" yaml:"workers"`
+	MaxPages      int        `json:"maxPages" yaml:"maxPages"`
+	Retry         Retry      `json:"retry" yaml:"retry"`
+	Inactivity    Inactivity `json:"inactivity" yaml:"inactivity"`
+	CollectAccess bool       `json:"collectAccess" yaml:"collectAccess"`
+}
+
+// Inactivity are the thresholds in days since the last activity
+// after which a user is considered idle or dormant.
+type Inactivity struct {
+	IdleDays    int `json:"idleDays" yaml:"idleDays"`
+	DormantDays int `json:"dormantDays" yaml:"dormantDays"`
+}
+
+// Audit is the configuration of the audit tracker. The lookback
+// is the time window queried when no checkpoint exists yet. If no
+// account IDs are given or discovery is enabled, every account in
+// the organization is tracked. The sink decides whether the audit
+// events are sent as metrics or as custom events.
+type Audit struct {
+	Lookback         Duration `json:"lookback" yaml:"lookback"`
+	DiscoverAccounts bool     `json:"discoverAccounts" yaml:"discoverAccounts"`
+	Workers          int      `json:"workers" yaml:"workers"`
+	Retry            Retry    `json:"retry" yaml:"retry"`
+	Sink             string   `json:"sink" yaml:"sink"`
+	Events           Events   `json:"events" yaml:"events"`
+}
+
+// Events is the configuration of the Event API sink. The events
+// are written to the given account which defaults to the first
+// configured account ID. A request carries at most the max batch
+// size of events and the max payload bytes uncompressed.
+type Events struct {
+	EventType       string `json:"eventType" yaml:"eventType"`
+	AccountId       int64  `json:"accountId" yaml:"accountId"`
+	MaxBatchSize    int    `json:"maxBatchSize" yaml:"maxBatchSize"`
+	MaxPayloadBytes int    `json:"maxPayloadBytes" yaml:"maxPayloadBytes"`
+}
+
+// Retry is the policy for the calls to New Relic. A failed call is
+// attempted again after an exponentially growing backoff which is
+// capped at the max backoff.
+type Retry struct {
+	MaxAttempts    int      `json:"maxAttempts" yaml:"maxAttempts"`
+	InitialBackoff Duration `json:"initialBackoff" yaml:"initialBackoff"`
+	MaxBackoff     Duration `json:"maxBackoff" yaml:"maxBackoff"`
+}
+
+// RateLimit bounds the NerdGraph requests of all trackers together.
+// A zero value disables the respective limit.
+type RateLimit struct {
+	RequestsPerSecond float64 `json:"requestsPerSecond" yaml:"requestsPerSecond"`
+	MaxInFlight       int     `json:"maxInFlight" yaml:"maxInFlight"`
+}
+
+// Redaction defines per attribute name whether the value is kept,
+// dropped, hashed or masked before it is forwarded to New Relic.
+// The hash key is required if any attribute is hashed. The emails
+// of an email change follow the action of tracker.users.email.
+type Redaction struct {
+	HashKey string            `json:"hashKey" yaml:"hashKey"`
+	Fields  map[string]string `json:"fields" yaml:"fields"`
+}
+
+// Output is a destination of the records of the trackers. The
+// records are written to every configured output. The path is the
+// newline delimited JSON file of the file output and the address is
+// where the Prometheus output serves its metrics.
+type Output struct {
+	Type    string `json:"type" yaml:"type"`
+	Path    string `json:"path" yaml:"path"`
+	Address string `json:"address" yaml:"address"`
+}
+
+// Export is the configuration of the export command. The users
+// are written as CSV to the given path or to the standard output
+// if none is given. The sort column is descending with a leading
+// minus. Masking hides the names and emails.
+type Export struct {
+	Path    string   `json:"path" yaml:"path"`
+	Columns []string `json:"columns" yaml:"columns"`
+	SortBy  string   `json:"sortBy" yaml:"sortBy"`
+	Mask    bool     `json:"mask" yaml:"mask"`
+}
+
+// Schedule defines how often the trackers run in daemon mode.
+type Schedule struct {
+	Users Job `json:"users" yaml:"users"`
+	Audit Job `json:"audit" yaml:"audit"`
+}
+
+// Timeouts are the deadlines of a tracker run and its phases.
+// A zero timeout sets no deadline.
+type Timeouts struct {
+	Run          Duration `json:"run" yaml:"run"`
+	Fetch        Duration `json:"fetch" yaml:"fetch"`
+	FlushMetrics Duration `json:"flushMetrics" yaml:"flushMetrics"`
+	FlushEvents  Duration `json:"flushEvents" yaml:"flushEvents"`
+	FlushLogs    Duration `json:"flushLogs" yaml:"flushLogs"`
+}
+
+// Job is the schedule of a single tracker. Every run is delayed
+// by a random duration between zero and the jitter. Without a
+// jitter, a tenth of the interval is used up to a default per
+// tracker.
+type Job struct {
+	Interval Duration  `json:"interval" yaml:"interval"`
+	Jitter   *Duration `json:"jitter" yaml:"jitter"`
+}
+
+type flagValues struct {
+	configPath       string
+	organizationId   string
+	accountIds       string
+	licenseKey       string
+	apiKey           string
+	logLevel         string
+	region           string
+	graphQlEndpoint  string
+	logsEndpoint     string
+	metricsEndpoint  string
+	eventsEndpoint   string
+	mode             string
+	usersInterval    Duration
+	usersJitter      Duration
+	auditInterval    Duration
+	auditJitter      Duration
+	runTimeout       Duration
+	stateDir         string
+	discoverAccounts bool
+	exportPath       string
+	exportColumns    string
+	exportSortBy     string
+	exportMask       bool
+}
+
+// Load creates the configuration out of the config file,
+// the environment variables and the given command line arguments.
+func Load(
+	args []string,
+) (
+	*Config,
+	error,
+) {
+	cfg := newDefaultConfig()
+
+	// The command precedes the flags
+	if len(args) != 0 && args[0] == COMMAND_EXPORT {
+		cfg.Command = COMMAND_EXPORT
+		args = args[1:]
+	}
+
+	// Parse flags first to get the config file path
+	fv, fs, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply config file
+	configPath := fv.configPath
+	if configPath == "" {
+		configPath = os.Getenv("NEWRELIC_TRACKER_CONFIG")
+	}
+	if configPath != "" {
+		err = cfg.applyFile(configPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Apply environment variables
+	err = cfg.applyEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply flags
+	err = cfg.applyFlags(fv, fs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the result
+	err = cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func newDefaultConfig() *Config {
+	return &Config{
+		AccountIds: []int64{},
+		LogLevel:   LOG_LEVEL_DEBUG,
+		Region:     region.EU,
+		Mode:       MODE_ONCE,
+		Schedule: Schedule{
+			Users: Job{
+				Interval: Duration(time.Hour),
+			},
+			Audit: Job{
+				Interval: Duration(5 * time.Minute),
+			},
+		},
+		Timeouts: Timeouts{
+			Run:          Duration(10 * time.Minute),
+			Fetch:        Duration(5 * time.Minute),
+			FlushMetrics: Duration(time.Minute),
+			FlushEvents:  Duration(time.Minute),
+			FlushLogs:    Duration(time.Minute),
+		},
+		StateDir: "state",
+		Outputs: []Output{
+			{Type: OUTPUT_NEW_RELIC},
+		},
+		RateLimit: RateLimit{
+			RequestsPerSecond: 5,
+			MaxInFlight:       5,
+		},
+		Users: Users{
+			Workers:  4,
+			MaxPages: 1000,
+			Retry:    newDefaultRetry(),
+			Inactivity: Inactivity{
+				IdleDays:    30,
+				DormantDays: 90,
+			},
+		},
+		Audit: Audit{
+			Lookback: Duration(24 * time.Hour),
+			Workers:  4,
+			Retry:    newDefaultRetry(),
+			Sink:     SINK_METRICS,
+			Events: Events{
+				EventType:       "UserAuditEvent",
+				MaxBatchSize:    2000,
+				MaxPayloadBytes: 1000000,
+			},
+		},
+	}
+}
+
+func newDefaultRetry() Retry {
+	return Retry{
+		MaxAttempts:    3,
+		InitialBackoff: Duration(time.Second),
+		MaxBackoff:     Duration(30 * time.Second),
+	}
+}
+
+func parseFlags(
+	args []string,
+) (
+	*flagValues,
+	*flag.FlagSet,
+	error,
+) {
+	fv := &flagValues{}
+	fs := flag.NewFlagSet("newrelic-tracker-user", flag.ContinueOnError)
+	fs.StringVar(&fv.configPath, "config", "", "path to the YAML or JSON config file")
+	fs.StringVar(&fv.organizationId, "organization-id", "", "New Relic organization ID")
+	fs.StringVar(&fv.accountIds, "account-ids", "", "comma separated New Relic account IDs")
+	fs.StringVar(&fv.licenseKey, "license-key", "", "New Relic license key")
+	fs.StringVar(&fv.apiKey, "api-key", "", "New Relic user API key")
+	fs.StringVar(&fv.logLevel, "log-level", "", "log level (DEBUG, ERROR)")
+	fs.StringVar(&fv.region, "region", "", "New Relic region (US, EU, FEDRAMP)")
+	fs.StringVar(&fv.graphQlEndpoint, "graphql-endpoint", "", "override for the GraphQL endpoint")
+	fs.StringVar(&fv.logsEndpoint, "logs-endpoint", "", "override for the Log API endpoint")
+	fs.StringVar(&fv.metricsEndpoint, "metrics-endpoint", "", "override for the Metric API endpoint")
+	fs.StringVar(&fv.eventsEndpoint, "events-endpoint", "", "override for the Event API endpoint")
+	fs.StringVar(&fv.mode, "mode", "", "run mode (once, daemon)")
+	fs.Var(&fv.usersInterval, "users-interval", "interval of the users tracker in daemon mode")
+	fs.Var(&fv.usersJitter, "users-jitter", "max random delay of the users tracker runs in daemon mode")
+	fs.Var(&fv.auditInterval, "audit-interval", "interval of the audit tracker in daemon mode")
+	fs.Var(&fv.auditJitter, "audit-jitter", "max random delay of the audit tracker runs in daemon mode")
+	fs.Var(&fv.runTimeout, "run-timeout", "overall time budget of a tracker run")
+	fs.StringVar(&fv.stateDir, "state-dir", "", "directory where the state between runs is kept")
+	fs.BoolVar(&fv.discoverAccounts, "discover-accounts", false, "track the audit events of all accounts in the organization")
+	fs.StringVar(&fv.exportPath, "export-path", "", "CSV file of the export command, standard output if not given")
+	fs.StringVar(&fv.exportColumns, "export-columns", "", "comma separated columns of the export")
+	fs.StringVar(&fv.exportSortBy, "export-sort", "", "column to sort the export by, descending with a leading minus")
+	fs.BoolVar(&fv.exportMask, "export-mask", false, "mask the names and emails in the export")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, nil, errors.New(CONFIG_FLAGS_COULD_NOT_BE_PARSED + ": " + err.Error())
+	}
+	return fv, fs, nil
+}
+
+func (c *Config) applyFile(
+	path string,
+) error {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return errors.New(CONFIG_FILE_COULD_NOT_BE_READ + ": " + err.Error())
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(bytes, c)
+	case ".json":
+		err = json.Unmarshal(bytes, c)
+	default:
+		return errors.New(CONFIG_FILE_FORMAT_IS_NOT_SUPPORTED + ": " + path)
+	}
+	if err != nil {
+		return errors.New(CONFIG_FILE_COULD_NOT_BE_PARSED + ": " + err.Error())
+	}
+	return nil
+}
+
+func (c *Config) applyEnv() error {
+	if val := os.Getenv("NEWRELIC_ORGANIZATION_ID"); val != "" {
+		c.OrganizationId = val
+	}
+	if val := os.Getenv("NEWRELIC_ACCOUNT_ID"); val != "" {
+		accountIds, err := parseAccountIds(val)
+		if err != nil {
+			return errors.New(CONFIG_ENVIRONMENT_VARIABLE_IS_MALFORMED + ": NEWRELIC_ACCOUNT_ID: " + err.Error())
+		}
+		c.AccountIds = accountIds
+	}
+	if val := os.Getenv("NEWRELIC_LICENSE_KEY"); val != "" {
+		c.LicenseKey = val
+	}
+	if val := os.Getenv("NEWRELIC_API_KEY"); val != "" {
+		c.ApiKey = val
+	}
+	if val := os.Getenv("NEWRELIC_LOG_LEVEL"); val != "" {
+		c.LogLevel = val
+	}
+	if val := os.Getenv("NEWRELIC_REDACTION_HASH_KEY"); val != "" {
+		c.Redaction.HashKey = val
+	}
+	if val := os.Getenv("NEWRELIC_REGION"); val != "" {
+		c.Region = val
+	}
+	if val := os.Getenv("NEWRELIC_GRAPHQL_ENDPOINT"); val != "" {
+		c.Endpoints.GraphQl = val
+	}
+	if val := os.Getenv("NEWRELIC_LOGS_ENDPOINT"); val != "" {
+		c.Endpoints.Logs = val
+	}
+	if val := os.Getenv("NEWRELIC_METRICS_ENDPOINT"); val != "" {
+		c.Endpoints.Metrics = val
+	}
+	if val := os.Getenv("NEWRELIC_EVENTS_ENDPOINT"); val != "" {
+		c.Endpoints.Events = val
+	}
+	if val := os.Getenv("NEWRELIC_AUDIT_SINK"); val != "" {
+		c.Audit.Sink = val
+	}
+	if val := os.Getenv("NEWRELIC_TRACKER_MODE"); val != "" {
+		c.Mode = val
+	}
+	if val := os.Getenv("NEWRELIC_USERS_INTERVAL"); val != "" {
+		err := c.Schedule.Users.Interval.Set(val)
+		if err != nil {
+			return errors.New(CONFIG_ENVIRONMENT_VARIABLE_IS_MALFORMED + ": NEWRELIC_USERS_INTERVAL: " + err.Error())
+		}
+	}
+	if val := os.Getenv("NEWRELIC_USERS_JITTER"); val != "" {
+		c.Schedule.Users.Jitter = new(Duration)
+		err := c.Schedule.Users.Jitter.Set(val)
+		if err != nil {
+			return errors.New(CONFIG_ENVIRONMENT_VARIABLE_IS_MALFORMED + ": NEWRELIC_USERS_JITTER: " + err.Error())
+		}
+	}
+	if val := os.Getenv("NEWRELIC_AUDIT_INTERVAL"); val != "" {
+		err := c.Schedule.Audit.Interval.Set(val)
+		if err != nil {
+			return errors.New(CONFIG_ENVIRONMENT_VARIABLE_IS_MALFORMED + ": NEWRELIC_AUDIT_INTERVAL: " + err.Error())
+		}
+	}
+	if val := os.Getenv("NEWRELIC_AUDIT_JITTER"); val != "" {
+		c.Schedule.Audit.Jitter = new(Duration)
+		err := c.Schedule.Audit.Jitter.Set(val)
+		if err != nil {
+			return errors.New(CONFIG_ENVIRONMENT_VARIABLE_IS_MALFORMED + ": NEWRELIC_AUDIT_JITTER: " + err.Error())
+		}
+	}
+	if val := os.Getenv("NEWRELIC_RUN_TIMEOUT"); val != "" {
+		err := c.Timeouts.Run.Set(val)
+		if err != nil {
+			return errors.New(CONFIG_ENVIRONMENT_VARIABLE_IS_MALFORMED + ": NEWRELIC_RUN_TIMEOUT: " + err.Error())
+		}
+	}
+	if val := os.Getenv("NEWRELIC_TRACKER_STATE_DIR"); val != "" {
+		c.StateDir = val
+	}
+	if val := os.Getenv("NEWRELIC_DISCOVER_ACCOUNTS"); val != "" {
+		discoverAccounts, err := strconv.ParseBool(val)
+		if err != nil {
+			return errors.New(CONFIG_ENVIRONMENT_VARIABLE_IS_MALFORMED + ": NEWRELIC_DISCOVER_ACCOUNTS: " + val)
+		}
+		c.Audit.DiscoverAccounts = discoverAccounts
+	}
+	return nil
+}
+
+func (c *Config) applyFlags(
+	fv *flagValues,
+	fs *flag.FlagSet,
+) error {
+	var err error
+
+	// Only the explicitly given flags override the other sources
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "organization-id":
+			c.OrganizationId = fv.organizationId
+		case "account-ids":
+			accountIds, parseErr := parseAccountIds(fv.accountIds)
+			if parseErr != nil {
+				err = parseErr
+				return
+			}
+			c.AccountIds = accountIds
+		case "license-key":
+			c.LicenseKey = fv.licenseKey
+		case "api-key":
+			c.ApiKey = fv.apiKey
+		case "log-level":
+			c.LogLevel = fv.logLevel
+		case "region":
+			c.Region = fv.region
+		case "graphql-endpoint":
+			c.Endpoints.GraphQl = fv.graphQlEndpoint
+		case "logs-endpoint":
+			c.Endpoints.Logs = fv.logsEndpoint
+		case "metrics-endpoint":
+			c.Endpoints.Metrics = fv.metricsEndpoint
+		case "events-endpoint":
+			c.Endpoints.Events = fv.eventsEndpoint
+		case "mode":
+			c.Mode = fv.mode
+		case "users-interval":
+			c.Schedule.Users.Interval = fv.usersInterval
+		case "users-jitter":
+			c.Schedule.Users.Jitter = &fv.usersJitter
+		case "audit-interval":
+			c.Schedule.Audit.Interval = fv.auditInterval
+		case "audit-jitter":
+			c.Schedule.Audit.Jitter = &fv.auditJitter
+		case "run-timeout":
+			c.Timeouts.Run = fv.runTimeout
+		case "state-dir":
+			c.StateDir = fv.stateDir
+		case "discover-accounts":
+			c.Audit.DiscoverAccounts = fv.discoverAccounts
+		case "export-path":
+			c.Export.Path = fv.exportPath
+		case "export-columns":
+			c.Export.Columns = strings.Split(fv.exportColumns, ",")
+		case "export-sort":
+			c.Export.SortBy = fv.exportSortBy
+		case "export-mask":
+			c.Export.Mask = fv.exportMask
+		}
+	})
+	if err != nil {
+		return errors.New(CONFIG_FLAGS_COULD_NOT_BE_PARSED + ": " + err.Error())
+	}
+	return nil
+}
+
+func parseAccountIds(
+	val string,
+) (
+	[]int64,
+	error,
+) {
+	accountIds := make([]int64, 0)
+	for _, s := range strings.Split(val, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		accountId, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, errors.New(CONFIG_ACCOUNT_ID_IS_INVALID + ": " + s)
+		}
+		accountIds = append(accountIds, accountId)
+	}
+	return accountIds, nil
+}
+
+// Validate checks the required fields and resolves the endpoints
+// of the configured region.
+func (c *Config) Validate() error {
+	problems := make([]string, 0)
+
+	if c.OrganizationId == "" {
+		problems = append(problems, CONFIG_ORGANIZATION_ID_IS_MISSING)
+	}
+	// The export only fetches the users
+	if len(c.AccountIds) == 0 && !c.Audit.DiscoverAccounts && c.Command != COMMAND_EXPORT {
+		problems = append(problems, CONFIG_ACCOUNT_IDS_ARE_MISSING)
+	}
+	for _, accountId := range c.AccountIds {
+		if accountId <= 0 {
+			problems = append(problems, CONFIG_ACCOUNT_ID_IS_INVALID+": "+strconv.FormatInt(accountId, 10))
+		}
+	}
+	if c.LicenseKey == "" && c.Command != COMMAND_EXPORT {
+		problems = append(problems, CONFIG_LICENSE_KEY_IS_MISSING)
+	}
+	if c.ApiKey == "" {
+		problems = append(problems, CONFIG_API_KEY_IS_MISSING)
+	}
+
+	c.LogLevel = strings.ToUpper(c.LogLevel)
+	if c.LogLevel != LOG_LEVEL_DEBUG && c.LogLevel != LOG_LEVEL_ERROR {
+		problems = append(problems, CONFIG_LOG_LEVEL_IS_INVALID+": "+c.LogLevel)
+	}
+
+	c.Mode = strings.ToLower(c.Mode)
+	if c.Mode != MODE_ONCE && c.Mode != MODE_DAEMON {
+		problems = append(problems, CONFIG_MODE_IS_INVALID+": "+c.Mode)
+	}
+	problems = append(problems, c.Schedule.Users.validate("users", 30*time.Second)...)
+	problems = append(problems, c.Schedule.Audit.validate("audit", 10*time.Second)...)
+	problems = append(problems, c.Timeouts.validate()...)
+
+	if c.StateDir == "" {
+		problems = append(problems, CONFIG_STATE_DIR_IS_MISSING)
+	}
+	if c.Audit.Lookback <= 0 {
+		problems = append(problems, CONFIG_LOOKBACK_IS_INVALID+": "+c.Audit.Lookback.String())
+	}
+	if c.Users.Workers < 1 {
+		problems = append(problems, CONFIG_WORKERS_ARE_INVALID+": users: "+strconv.Itoa(c.Users.Workers))
+	}
+	if c.Users.MaxPages < 1 {
+		problems = append(problems, CONFIG_MAX_PAGES_ARE_INVALID+": users: "+strconv.Itoa(c.Users.MaxPages))
+	}
+	if c.Audit.Workers < 1 {
+		problems = append(problems, CONFIG_WORKERS_ARE_INVALID+": audit: "+strconv.Itoa(c.Audit.Workers))
+	}
+	if c.RateLimit.RequestsPerSecond < 0 {
+		problems = append(problems, CONFIG_RATE_LIMIT_IS_INVALID+": requestsPerSecond: "+strconv.FormatFloat(c.RateLimit.RequestsPerSecond, 'f', -1, 64))
+	}
+	if c.RateLimit.MaxInFlight < 0 {
+		problems = append(problems, CONFIG_RATE_LIMIT_IS_INVALID+": maxInFlight: "+strconv.Itoa(c.RateLimit.MaxInFlight))
+	}
+	if c.Users.Inactivity.IdleDays < 1 || c.Users.Inactivity.DormantDays <= c.Users.Inactivity.IdleDays {
+		problems = append(problems, CONFIG_INACTIVITY_IS_INVALID+": "+strconv.Itoa(c.Users.Inactivity.IdleDays)+"/"+strconv.Itoa(c.Users.Inactivity.DormantDays))
+	}
+	problems = append(problems, c.Users.Retry.validate("users")...)
+	problems = append(problems, c.Audit.Retry.validate("audit")...)
+
+	c.Audit.Sink = strings.ToLower(c.Audit.Sink)
+	switch c.Audit.Sink {
+	case SINK_METRICS:
+	case SINK_EVENTS:
+		if c.Audit.Events.AccountId == 0 && len(c.AccountIds) != 0 {
+			c.Audit.Events.AccountId = c.AccountIds[0]
+		}
+		problems = append(problems, c.Audit.Events.validate()...)
+	default:
+		problems = append(problems, CONFIG_SINK_IS_INVALID+": audit: "+c.Audit.Sink)
+	}
+
+	problems = append(problems, c.validateOutputs()...)
+	problems = append(problems, c.Export.validate()...)
+
+	redactor, err := redact.NewRedactor(c.Redaction.HashKey, c.Redaction.Fields)
+	if err != nil {
+		problems = append(problems, CONFIG_REDACTION_IS_INVALID+": "+err.Error())
+	} else {
+		c.redactor = redactor
+	}
+
+	endpoints, err := region.NewEndpoints(c.Region, c.Endpoints)
+	if err != nil {
+		problems = append(problems, CONFIG_ENDPOINTS_COULD_NOT_BE_RESOLVED+": "+err.Error())
+	} else {
+		c.Endpoints = *endpoints
+	}
+
+	if len(problems) != 0 {
+		return errors.New(CONFIG_CONFIGURATION_IS_INVALID + ": " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Redactor returns the redactor of the validated redaction. It is
+// nil and keeps every attribute if the config was not validated.
+func (c *Config) Redactor() *redact.Redactor {
+	return c.redactor
+}
+
+// validate defaults the jitter to a tenth of the interval which is
+// capped at the given max so that short intervals remain valid.
+func (j *Job) validate(
+	name string,
+	maxDefaultJitter time.Duration,
+) []string {
+	problems := make([]string, 0)
+	if j.Interval <= 0 {
+		problems = append(problems, CONFIG_INTERVAL_IS_INVALID+": "+name+": "+j.Interval.String())
+		return problems
+	}
+	if j.Jitter == nil {
+		jitter := Duration(j.Interval.Duration() / 10)
+		if jitter > Duration(maxDefaultJitter) {
+			jitter = Duration(maxDefaultJitter)
+		}
+		j.Jitter = &jitter
+	}
+	if *j.Jitter < 0 || *j.Jitter >= j.Interval {
+		problems = append(problems, CONFIG_JITTER_IS_INVALID+": "+name+": "+j.Jitter.String())
+	}
+	return problems
+}
+
+func (c *Config) validateOutputs() []string {
+	outputs := c.Outputs
+	problems := make([]string, 0)
+	if len(outputs) == 0 {
+		problems = append(problems, CONFIG_OUTPUTS_ARE_INVALID+": no output is given")
+	}
+	for i := range outputs {
+		outputs[i].Type = strings.ToLower(outputs[i].Type)
+		switch outputs[i].Type {
+		case OUTPUT_NEW_RELIC, OUTPUT_STDOUT:
+		case OUTPUT_FILE:
+			if outputs[i].Path == "" {
+				problems = append(problems, CONFIG_OUTPUTS_ARE_INVALID+": file: path is missing")
+			}
+		case OUTPUT_PROMETHEUS:
+			// The values are only refreshed by the scheduled runs
+			if c.Mode != MODE_DAEMON {
+				problems = append(problems, CONFIG_OUTPUTS_ARE_INVALID+": prometheus: requires daemon mode")
+			}
+			if outputs[i].Address == "" {
+				outputs[i].Address = DEFAULT_PROMETHEUS_ADDRESS
+			}
+		default:
+			problems = append(problems, CONFIG_OUTPUTS_ARE_INVALID+": "+outputs[i].Type)
+		}
+	}
+	return problems
+}
+
+// GetPrometheusAddress returns the address of the Prometheus output
+// and whether one is configured.
+func (c *Config) GetPrometheusAddress() (
+	string,
+	bool,
+) {
+	for _, output := range c.Outputs {
+		if output.Type == OUTPUT_PROMETHEUS {
+			return output.Address, true
+		}
+	}
+	return "", false
+}
+
+// validate sets all columns if none are given and checks that the
+// columns and the sort column are known.
+func (e *Export) validate() []string {
+	problems := make([]string, 0)
+	known := map[string]bool{}
+	for _, column := range ExportColumns {
+		known[column] = true
+	}
+
+	if len(e.Columns) == 0 {
+		e.Columns = append([]string{}, ExportColumns...)
+	}
+	for i := range e.Columns {
+		e.Columns[i] = strings.TrimSpace(e.Columns[i])
+		if !known[e.Columns[i]] {
+			problems = append(problems, CONFIG_EXPORT_IS_INVALID+": column: "+e.Columns[i])
+		}
+	}
+	if e.SortBy != "" && !known[strings.TrimPrefix(e.SortBy, "-")] {
+		problems = append(problems, CONFIG_EXPORT_IS_INVALID+": sort: "+e.SortBy)
+	}
+	return problems
+}
+
+func (e *Events) validate() []string {
+	problems := make([]string, 0)
+	if e.EventType == "" {
+		problems = append(problems, CONFIG_EVENTS_ARE_INVALID+": eventType is missing")
+	}
+	if e.AccountId <= 0 {
+		problems = append(problems, CONFIG_EVENTS_ARE_INVALID+": accountId: "+strconv.FormatInt(e.AccountId, 10))
+	}
+	if e.MaxBatchSize < 1 {
+		problems = append(problems, CONFIG_EVENTS_ARE_INVALID+": maxBatchSize: "+strconv.Itoa(e.MaxBatchSize))
+	}
+	if e.MaxPayloadBytes < 1 {
+		problems = append(problems, CONFIG_EVENTS_ARE_INVALID+": maxPayloadBytes: "+strconv.Itoa(e.MaxPayloadBytes))
+	}
+	return problems
+}
+
+func (t *Timeouts) validate() []string {
+	problems := make([]string, 0)
+	for name, timeout := range map[string]Duration{
+		"run":          t.Run,
+		"fetch":        t.Fetch,
+		"flushMetrics": t.FlushMetrics,
+		"flushEvents":  t.FlushEvents,
+		"flushLogs":    t.FlushLogs,
+	} {
+		if timeout < 0 {
+			problems = append(problems, CONFIG_TIMEOUT_IS_INVALID+": "+name+": "+timeout.String())
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+func (r *Retry) validate(
+	name string,
+) []string {
+	problems := make([]string, 0)
+	if r.MaxAttempts < 1 {
+		problems = append(problems, CONFIG_RETRY_IS_INVALID+": "+name+": maxAttempts: "+strconv.Itoa(r.MaxAttempts))
+	}
+	if r.InitialBackoff <= 0 {
+		problems = append(problems, CONFIG_RETRY_IS_INVALID+": "+name+": initialBackoff: "+r.InitialBackoff.String())
+	}
+	if r.MaxBackoff < r.InitialBackoff {
+		problems = append(problems, CONFIG_RETRY_IS_INVALID+": "+name+": maxBackoff: "+r.MaxBackoff.String())
+	}
+	return problems
+}
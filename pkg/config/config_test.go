@@ -0,0 +1,405 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setRequiredEnv(t *testing.T) {
+	t.Setenv("NEWRELIC_ORGANIZATION_ID", "organizationId")
+	t.Setenv("NEWRELIC_ACCOUNT_ID", "12345")
+	t.Setenv("NEWRELIC_LICENSE_KEY", "licenseKey")
+	t.Setenv("NEWRELIC_API_KEY", "apiKey")
+}
+
+func writeConfigFile(
+	t *testing.T,
+	name string,
+	content string,
+) string {
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		panic(err)
+	}
+	return path
+}
+
+func Test_MissingRequiredFieldsFail(t *testing.T) {
+	t.Setenv("NEWRELIC_ORGANIZATION_ID", "")
+	t.Setenv("NEWRELIC_ACCOUNT_ID", "")
+	t.Setenv("NEWRELIC_LICENSE_KEY", "")
+	t.Setenv("NEWRELIC_API_KEY", "")
+
+	cfg, err := Load([]string{})
+
+	assert.Nil(t, cfg)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), CONFIG_ORGANIZATION_ID_IS_MISSING)
+	assert.Contains(t, err.Error(), CONFIG_ACCOUNT_IDS_ARE_MISSING)
+	assert.Contains(t, err.Error(), CONFIG_LICENSE_KEY_IS_MISSING)
+	assert.Contains(t, err.Error(), CONFIG_API_KEY_IS_MISSING)
+}
+
+func Test_MalformedAccountIdFails(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("NEWRELIC_ACCOUNT_ID", "12345,abc")
+
+	_, err := Load([]string{})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), CONFIG_ACCOUNT_ID_IS_INVALID)
+}
+
+func Test_InvalidLogLevelFails(t *testing.T) {
+	setRequiredEnv(t)
+
+	_, err := Load([]string{"-log-level", "TRACE"})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), CONFIG_LOG_LEVEL_IS_INVALID)
+}
+
+func Test_UnknownRegionFails(t *testing.T) {
+	setRequiredEnv(t)
+
+	_, err := Load([]string{"-region", "APAC"})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), CONFIG_ENDPOINTS_COULD_NOT_BE_RESOLVED)
+}
+
+func Test_EnvironmentIsLoaded(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("NEWRELIC_ACCOUNT_ID", "12345, 67890")
+
+	cfg, err := Load([]string{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "organizationId", cfg.OrganizationId)
+	assert.Equal(t, []int64{12345, 67890}, cfg.AccountIds)
+	assert.Equal(t, LOG_LEVEL_DEBUG, cfg.LogLevel)
+	assert.Equal(t, "https://api.eu.newrelic.com/graphql", cfg.Endpoints.GraphQl)
+}
+
+func Test_PrecedenceIsFileThenEnvThenFlags(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("NEWRELIC_ORGANIZATION_ID", "")
+	t.Setenv("NEWRELIC_REGION", "US")
+
+	path := writeConfigFile(t, "config.yaml", `
+organizationId: fileOrganizationId
+region: EU
+logLevel: ERROR
+endpoints:
+  metrics: http://localhost/metric/v1
+`)
+
+	cfg, err := Load([]string{"-config", path, "-log-level", "debug"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "fileOrganizationId", cfg.OrganizationId)
+	assert.Equal(t, "US", cfg.Region)
+	assert.Equal(t, LOG_LEVEL_DEBUG, cfg.LogLevel)
+	assert.Equal(t, "https://api.newrelic.com/graphql", cfg.Endpoints.GraphQl)
+	assert.Equal(t, "http://localhost/metric/v1", cfg.Endpoints.Metrics)
+}
+
+func Test_JsonFileIsLoaded(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("NEWRELIC_ACCOUNT_ID", "")
+
+	path := writeConfigFile(t, "config.json", `{"accountIds": [1, 2]}`)
+
+	cfg, err := Load([]string{"-config", path})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 2}, cfg.AccountIds)
+}
+
+func Test_UnsupportedFileFormatFails(t *testing.T) {
+	setRequiredEnv(t)
+
+	path := writeConfigFile(t, "config.toml", "")
+
+	_, err := Load([]string{"-config", path})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), CONFIG_FILE_FORMAT_IS_NOT_SUPPORTED)
+}
+
+func Test_ScheduleIsLoaded(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("NEWRELIC_AUDIT_INTERVAL", "2m")
+
+	path := writeConfigFile(t, "config.yaml", `
+mode: daemon
+schedule:
+  users:
+    interval: 2h
+    jitter: 1m
+`)
+
+	cfg, err := Load([]string{"-config", path})
+
+	assert.Nil(t, err)
+	assert.Equal(t, MODE_DAEMON, cfg.Mode)
+	assert.Equal(t, 2*time.Hour, cfg.Schedule.Users.Interval.Duration())
+	assert.Equal(t, time.Minute, cfg.Schedule.Users.Jitter.Duration())
+	assert.Equal(t, 2*time.Minute, cfg.Schedule.Audit.Interval.Duration())
+}
+
+func Test_DefaultJitterFitsShortIntervals(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("NEWRELIC_AUDIT_JITTER", "5s")
+
+	cfg, err := Load([]string{"-users-interval", "20s"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2*time.Second, cfg.Schedule.Users.Jitter.Duration())
+	assert.Equal(t, 5*time.Second, cfg.Schedule.Audit.Jitter.Duration())
+
+	cfg, err = Load([]string{"-audit-jitter", "1s"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 30*time.Second, cfg.Schedule.Users.Jitter.Duration())
+	assert.Equal(t, time.Second, cfg.Schedule.Audit.Jitter.Duration())
+}
+
+func Test_InvalidScheduleFails(t *testing.T) {
+	setRequiredEnv(t)
+
+	_, err := Load([]string{"-mode", "forever", "-users-interval", "0s"})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), CONFIG_MODE_IS_INVALID)
+	assert.Contains(t, err.Error(), CONFIG_INTERVAL_IS_INVALID)
+}
+
+func Test_RetryIsLoadedPerTracker(t *testing.T) {
+	setRequiredEnv(t)
+
+	path := writeConfigFile(t, "config.yaml", `
+users:
+  retry:
+    maxAttempts: 5
+    initialBackoff: 2s
+    maxBackoff: 1m
+audit:
+  retry:
+    maxAttempts: 0
+`)
+
+	_, err := Load([]string{"-config", path})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), CONFIG_RETRY_IS_INVALID+": audit: maxAttempts: 0")
+
+	path = writeConfigFile(t, "config.yaml", `
+users:
+  retry:
+    maxAttempts: 5
+    initialBackoff: 2s
+    maxBackoff: 1m
+`)
+
+	cfg, err := Load([]string{"-config", path})
+	assert.Nil(t, err)
+	assert.Equal(t, 5, cfg.Users.Retry.MaxAttempts)
+	assert.Equal(t, 2*time.Second, cfg.Users.Retry.InitialBackoff.Duration())
+	assert.Equal(t, time.Minute, cfg.Users.Retry.MaxBackoff.Duration())
+	assert.Equal(t, 3, cfg.Audit.Retry.MaxAttempts)
+}
+
+func Test_AccessCollectionIsOptIn(t *testing.T) {
+	setRequiredEnv(t)
+
+	cfg, err := Load([]string{})
+	assert.Nil(t, err)
+	assert.False(t, cfg.Users.CollectAccess)
+
+	path := writeConfigFile(t, "config.yaml", `
+users:
+  collectAccess: true
+`)
+
+	cfg, err = Load([]string{"-config", path})
+	assert.Nil(t, err)
+	assert.True(t, cfg.Users.CollectAccess)
+}
+
+func Test_RateLimitIsLoaded(t *testing.T) {
+	setRequiredEnv(t)
+
+	path := writeConfigFile(t, "config.json", `{"rateLimit": {"requestsPerSecond": 2.5, "maxInFlight": 0}}`)
+
+	cfg, err := Load([]string{"-config", path})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2.5, cfg.RateLimit.RequestsPerSecond)
+	assert.Equal(t, 0, cfg.RateLimit.MaxInFlight)
+}
+
+func Test_InactivityThresholdsAreValidated(t *testing.T) {
+	setRequiredEnv(t)
+
+	path := writeConfigFile(t, "config.yaml", `
+users:
+  inactivity:
+    idleDays: 60
+    dormantDays: 45
+`)
+
+	_, err := Load([]string{"-config", path})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), CONFIG_INACTIVITY_IS_INVALID+": 60/45")
+}
+
+func Test_RedactionIsLoaded(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("NEWRELIC_REDACTION_HASH_KEY", "secret")
+
+	path := writeConfigFile(t, "config.yaml", `
+redaction:
+  fields:
+    tracker.users.email: hash
+    tracker.users.name: drop
+`)
+
+	cfg, err := Load([]string{"-config", path})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", cfg.Redaction.HashKey)
+	assert.NotNil(t, cfg.Redactor())
+	assert.NotContains(t, cfg.Redactor().Apply(map[string]string{"tracker.users.name": "John"}), "tracker.users.name")
+}
+
+func Test_RedactionWithoutHashKeyFails(t *testing.T) {
+	setRequiredEnv(t)
+
+	path := writeConfigFile(t, "config.yaml", `
+redaction:
+  fields:
+    tracker.users.email: hash
+`)
+
+	_, err := Load([]string{"-config", path})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), CONFIG_REDACTION_IS_INVALID)
+}
+
+func Test_EventSinkDefaultsToFirstAccount(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("NEWRELIC_AUDIT_SINK", "EVENTS")
+
+	cfg, err := Load([]string{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, SINK_EVENTS, cfg.Audit.Sink)
+	assert.Equal(t, int64(12345), cfg.Audit.Events.AccountId)
+	assert.Equal(t, "UserAuditEvent", cfg.Audit.Events.EventType)
+}
+
+func Test_InvalidSinkFails(t *testing.T) {
+	setRequiredEnv(t)
+
+	path := writeConfigFile(t, "config.yaml", `
+audit:
+  sink: traces
+`)
+
+	_, err := Load([]string{"-config", path})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), CONFIG_SINK_IS_INVALID+": audit: traces")
+}
+
+func Test_OutputsAreLoaded(t *testing.T) {
+	setRequiredEnv(t)
+
+	path := writeConfigFile(t, "config.yaml", `
+outputs:
+  - type: Stdout
+  - type: file
+    path: records.ndjson
+`)
+
+	cfg, err := Load([]string{"-config", path})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Output{
+		{Type: OUTPUT_STDOUT},
+		{Type: OUTPUT_FILE, Path: "records.ndjson"},
+	}, cfg.Outputs)
+}
+
+func Test_FileOutputWithoutPathFails(t *testing.T) {
+	setRequiredEnv(t)
+
+	path := writeConfigFile(t, "config.yaml", `
+outputs:
+  - type: file
+`)
+
+	_, err := Load([]string{"-config", path})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), CONFIG_OUTPUTS_ARE_INVALID+": file: path is missing")
+}
+
+func Test_ExportCommandIsLoaded(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("NEWRELIC_ACCOUNT_ID", "")
+	t.Setenv("NEWRELIC_LICENSE_KEY", "")
+
+	cfg, err := Load([]string{"export", "-export-columns", "email, userId", "-export-sort", "-email", "-export-mask"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, COMMAND_EXPORT, cfg.Command)
+	assert.Equal(t, []string{EXPORT_COLUMN_EMAIL, EXPORT_COLUMN_USER_ID}, cfg.Export.Columns)
+	assert.Equal(t, "-email", cfg.Export.SortBy)
+	assert.True(t, cfg.Export.Mask)
+}
+
+func Test_ExportDefaultsToAllColumns(t *testing.T) {
+	setRequiredEnv(t)
+
+	cfg, err := Load([]string{"export"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, ExportColumns, cfg.Export.Columns)
+}
+
+func Test_UnknownExportColumnFails(t *testing.T) {
+	setRequiredEnv(t)
+
+	_, err := Load([]string{"export", "-export-columns", "password", "-export-sort", "salary"})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), CONFIG_EXPORT_IS_INVALID+": column: password")
+	assert.Contains(t, err.Error(), CONFIG_EXPORT_IS_INVALID+": sort: salary")
+}
+
+func Test_PrometheusOutputRequiresDaemonMode(t *testing.T) {
+	setRequiredEnv(t)
+
+	path := writeConfigFile(t, "config.yaml", `
+outputs:
+  - type: prometheus
+`)
+
+	_, err := Load([]string{"-config", path})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), CONFIG_OUTPUTS_ARE_INVALID+": prometheus: requires daemon mode")
+
+	cfg, err := Load([]string{"-config", path, "-mode", "daemon"})
+	assert.Nil(t, err)
+	address, ok := cfg.GetPrometheusAddress()
+	assert.True(t, ok)
+	assert.Equal(t, DEFAULT_PROMETHEUS_ADDRESS, address)
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	CONFIG_DURATION_IS_INVALID = "duration is invalid"
+)
+
+// Duration is a time.Duration which can be given as a string
+// like "5m" in config files, environment variables and flags.
+type Duration time.Duration
+
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Set implements flag.Value.
+func (d *Duration) Set(
+	val string,
+) error {
+	parsed, err := time.ParseDuration(val)
+	if err != nil {
+		return errors.New(CONFIG_DURATION_IS_INVALID + ": " + val)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(
+	bytes []byte,
+) error {
+	var val string
+	err := json.Unmarshal(bytes, &val)
+	if err != nil {
+		return errors.New(CONFIG_DURATION_IS_INVALID + ": " + string(bytes))
+	}
+	return d.Set(val)
+}
+
+func (d *Duration) UnmarshalYAML(
+	node *yaml.Node,
+) error {
+	return d.Set(node.Value)
+}
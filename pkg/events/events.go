@@ -0,0 +1,248 @@
+package events
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logging "github.com/utr1903/newrelic-tracker-internal/logging"
+	"github.com/utr1903/newrelic-tracker-user/pkg/httpstatus"
+)
+
+const (
+	EVENTS_PAYLOAD_COULD_NOT_BE_CREATED     = "event payload could not be created"
+	EVENTS_REQUEST_COULD_NOT_BE_CREATED     = "event request could not be created"
+	EVENTS_REQUEST_HAS_FAILED               = "event request has failed"
+	EVENTS_NEW_RELIC_RETURNED_NOT_OK_STATUS = "new relic has returned not ok status for events"
+	EVENTS_EVENT_IS_TOO_LARGE               = "event exceeds the max payload size and is dropped"
+	EVENTS_ARE_FORWARDED                    = "events are forwarded"
+)
+
+const (
+	// DEFAULT_MAX_BATCH_SIZE is the number of events which are sent
+	// in a single request at most.
+	DEFAULT_MAX_BATCH_SIZE = 2000
+	// DEFAULT_MAX_PAYLOAD_BYTES bounds the uncompressed payload of a
+	// request which keeps it well below the compressed limit of 1MB.
+	DEFAULT_MAX_PAYLOAD_BYTES = 1000000
+)
+
+// IEventForwarder collects custom events and sends them to the
+// New Relic Event API.
+type IEventForwarder interface {
+	AddEvent(
+		eventType string,
+		timestamp int64,
+		attributes map[string]string,
+	)
+	Run(ctx context.Context) error
+}
+
+type event struct {
+	eventType  string
+	timestamp  int64
+	attributes map[string]string
+}
+
+// EventForwarder sends the added events in batches which are split
+// by the number of events and the size of the payload. The events
+// of the successful batches are removed so that a failed run can be
+// repeated without duplicates.
+type EventForwarder struct {
+	Logger           logging.ILogger
+	HttpClient       *http.Client
+	LicenseKey       string
+	Endpoint         string
+	CommonAttributes map[string]string
+	MaxBatchSize     int
+	MaxPayloadBytes  int
+
+	events []event
+}
+
+// NewEventForwarder creates a forwarder which writes the events to
+// the given account. The endpoint is the base URL of the Event API.
+func NewEventForwarder(
+	logger logging.ILogger,
+	licenseKey string,
+	endpoint string,
+	accountId int64,
+	commonAttributes map[string]string,
+	maxBatchSize int,
+	maxPayloadBytes int,
+) *EventForwarder {
+	if maxBatchSize <= 0 {
+		maxBatchSize = DEFAULT_MAX_BATCH_SIZE
+	}
+	if maxPayloadBytes <= 0 {
+		maxPayloadBytes = DEFAULT_MAX_PAYLOAD_BYTES
+	}
+	return &EventForwarder{
+		Logger: logger,
+		HttpClient: &http.Client{
+			Timeout: time.Duration(30 * time.Second),
+		},
+		LicenseKey:       licenseKey,
+		Endpoint:         strings.TrimSuffix(endpoint, "/") + "/" + strconv.FormatInt(accountId, 10) + "/events",
+		CommonAttributes: commonAttributes,
+		MaxBatchSize:     maxBatchSize,
+		MaxPayloadBytes:  maxPayloadBytes,
+		events:           []event{},
+	}
+}
+
+func (ef *EventForwarder) AddEvent(
+	eventType string,
+	timestamp int64,
+	attributes map[string]string,
+) {
+	ef.events = append(ef.events, event{
+		eventType:  eventType,
+		timestamp:  timestamp,
+		attributes: attributes,
+	})
+}
+
+// Run sends the pending events. The events of the batches which
+// have been sent are removed even if a later batch fails.
+func (ef *EventForwarder) Run(
+	ctx context.Context,
+) error {
+	encoded := make([][]byte, 0, len(ef.events))
+	for _, e := range ef.events {
+		payload, err := ef.encode(e)
+		if err != nil {
+			return errors.New(EVENTS_PAYLOAD_COULD_NOT_BE_CREATED + ": " + err.Error())
+		}
+		encoded = append(encoded, payload)
+	}
+
+	for len(encoded) != 0 {
+		batch, size := ef.nextBatch(encoded)
+		if size == 0 {
+			ef.Logger.LogWithFields(logrus.ErrorLevel, EVENTS_EVENT_IS_TOO_LARGE,
+				map[string]string{
+					"tracker.package":   "pkg.events",
+					"tracker.file":      "events.go",
+					"tracker.eventType": ef.events[0].eventType,
+					"tracker.size":      strconv.Itoa(len(encoded[0])),
+				})
+			encoded = encoded[1:]
+			ef.events = ef.events[1:]
+			continue
+		}
+
+		err := ef.send(ctx, batch)
+		if err != nil {
+			return err
+		}
+		ef.Logger.LogWithFields(logrus.DebugLevel, EVENTS_ARE_FORWARDED,
+			map[string]string{
+				"tracker.package": "pkg.events",
+				"tracker.file":    "events.go",
+				"tracker.count":   strconv.Itoa(size),
+			})
+		encoded = encoded[size:]
+		ef.events = ef.events[size:]
+	}
+	return nil
+}
+
+// encode returns the JSON object of the event where the common
+// attributes are overridden by the attributes of the event. Without
+// a timestamp the time of ingestion is used.
+func (ef *EventForwarder) encode(
+	e event,
+) (
+	[]byte,
+	error,
+) {
+	obj := make(map[string]any, len(ef.CommonAttributes)+len(e.attributes)+2)
+	for key, val := range ef.CommonAttributes {
+		obj[key] = val
+	}
+	for key, val := range e.attributes {
+		obj[key] = val
+	}
+	obj["eventType"] = e.eventType
+	if e.timestamp != 0 {
+		obj["timestamp"] = e.timestamp
+	}
+	return json.Marshal(obj)
+}
+
+// nextBatch returns the JSON array of the leading events which fit
+// into a single request together with their number. A number of 0
+// means that the first event alone exceeds the payload size.
+func (ef *EventForwarder) nextBatch(
+	encoded [][]byte,
+) (
+	[]byte,
+	int,
+) {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	count := 0
+	for _, payload := range encoded {
+		if count == ef.MaxBatchSize || buf.Len()+len(payload)+2 > ef.MaxPayloadBytes {
+			break
+		}
+		if count != 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(payload)
+		count++
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), count
+}
+
+func (ef *EventForwarder) send(
+	ctx context.Context,
+	batch []byte,
+) error {
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	_, err := zw.Write(batch)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		return errors.New(EVENTS_PAYLOAD_COULD_NOT_BE_CREATED + ": " + err.Error())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ef.Endpoint, &body)
+	if err != nil {
+		return errors.New(EVENTS_REQUEST_COULD_NOT_BE_CREATED + ": " + err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Api-Key", ef.LicenseKey)
+
+	res, err := ef.HttpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", EVENTS_REQUEST_HAS_FAILED, err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	// Rate limits and server errors are worth retrying
+	if httpstatus.IsRetryable(res.StatusCode) {
+		return fmt.Errorf("%s: %w", EVENTS_NEW_RELIC_RETURNED_NOT_OK_STATUS, &httpstatus.StatusError{
+			StatusCode: res.StatusCode,
+		})
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.New(EVENTS_NEW_RELIC_RETURNED_NOT_OK_STATUS + ": " + strconv.Itoa(res.StatusCode))
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package events
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/utr1903/newrelic-tracker-user/pkg/httpstatus"
+)
+
+type loggerMock struct {
+	msgs []string
+}
+
+func (l *loggerMock) LogWithFields(
+	lvl logrus.Level,
+	msg string,
+	attributes map[string]string,
+) {
+	l.msgs = append(l.msgs, msg)
+}
+
+func (l *loggerMock) Flush() error {
+	return nil
+}
+
+// eventApiMock records the decoded batches and answers with the
+// given status codes in order. The last one is repeated.
+type eventApiMock struct {
+	statusCodes []int
+	batches     [][]map[string]any
+	paths       []string
+}
+
+func (m *eventApiMock) ServeHTTP(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	statusCode := m.statusCodes[0]
+	if len(m.statusCodes) > 1 {
+		m.statusCodes = m.statusCodes[1:]
+	}
+	if statusCode == http.StatusOK {
+		zr, _ := gzip.NewReader(r.Body)
+		batch := []map[string]any{}
+		json.NewDecoder(zr).Decode(&batch)
+		m.batches = append(m.batches, batch)
+		m.paths = append(m.paths, r.URL.Path)
+	}
+	w.WriteHeader(statusCode)
+}
+
+func newForwarder(
+	endpoint string,
+	maxBatchSize int,
+	maxPayloadBytes int,
+) *EventForwarder {
+	return NewEventForwarder(
+		&loggerMock{},
+		"licenseKey",
+		endpoint,
+		12345,
+		map[string]string{"tracker.organizationId": "org"},
+		maxBatchSize,
+		maxPayloadBytes,
+	)
+}
+
+func Test_EventsAreSentInBatches(t *testing.T) {
+	api := &eventApiMock{statusCodes: []int{http.StatusOK}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	ef := newForwarder(server.URL+"/v1/accounts", 2, 0)
+	for i := 0; i < 5; i++ {
+		ef.AddEvent("UserAuditEvent", int64(i), map[string]string{"id": "x"})
+	}
+	err := ef.Run(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(api.batches))
+	assert.Equal(t, 1, len(api.batches[2]))
+	assert.Equal(t, "/v1/accounts/12345/events", api.paths[0])
+	assert.Equal(t, "UserAuditEvent", api.batches[0][0]["eventType"])
+	assert.Equal(t, "org", api.batches[0][0]["tracker.organizationId"])
+	assert.Equal(t, "x", api.batches[0][0]["id"])
+}
+
+func Test_BatchesAreSplitByPayloadSize(t *testing.T) {
+	api := &eventApiMock{statusCodes: []int{http.StatusOK}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	ef := newForwarder(server.URL, 0, 250)
+	for i := 0; i < 4; i++ {
+		ef.AddEvent("UserAuditEvent", 0, map[string]string{"description": strings.Repeat("x", 60)})
+	}
+	err := ef.Run(context.Background())
+
+	assert.Nil(t, err)
+	assert.True(t, len(api.batches) > 1)
+	count := 0
+	for _, batch := range api.batches {
+		count += len(batch)
+	}
+	assert.Equal(t, 4, count)
+}
+
+func Test_TooLargeEventIsDropped(t *testing.T) {
+	api := &eventApiMock{statusCodes: []int{http.StatusOK}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	logger := &loggerMock{}
+	ef := newForwarder(server.URL, 0, 200)
+	ef.Logger = logger
+	ef.AddEvent("UserAuditEvent", 0, map[string]string{"description": strings.Repeat("x", 500)})
+	ef.AddEvent("UserAuditEvent", 0, map[string]string{"id": "x"})
+	err := ef.Run(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(api.batches))
+	assert.Equal(t, "x", api.batches[0][0]["id"])
+	assert.Contains(t, logger.msgs, EVENTS_EVENT_IS_TOO_LARGE)
+}
+
+func Test_FailedBatchIsKeptForNextRun(t *testing.T) {
+	api := &eventApiMock{statusCodes: []int{http.StatusOK, http.StatusServiceUnavailable, http.StatusOK}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	ef := newForwarder(server.URL, 1, 0)
+	ef.AddEvent("UserAuditEvent", 0, map[string]string{"id": "a"})
+	ef.AddEvent("UserAuditEvent", 0, map[string]string{"id": "b"})
+
+	err := ef.Run(context.Background())
+
+	var statusErr *httpstatus.StatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode)
+
+	err = ef.Run(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(api.batches))
+	assert.Equal(t, "a", api.batches[0][0]["id"])
+	assert.Equal(t, "b", api.batches[1][0]["id"])
+}
+
+func Test_ClientErrorIsNotRetryable(t *testing.T) {
+	api := &eventApiMock{statusCodes: []int{http.StatusForbidden}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	ef := newForwarder(server.URL, 0, 0)
+	ef.AddEvent("UserAuditEvent", 0, map[string]string{})
+	err := ef.Run(context.Background())
+
+	var statusErr *httpstatus.StatusError
+	assert.NotNil(t, err)
+	assert.False(t, errors.As(err, &statusErr))
+	assert.Equal(t, EVENTS_NEW_RELIC_RETURNED_NOT_OK_STATUS+": 403", err.Error())
+}
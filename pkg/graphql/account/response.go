@@ -0,0 +1,26 @@
+package account
+
+import "github.com/utr1903/newrelic-tracker-user/pkg/graphql/gqlerror"
+
+// --- GraphQL for account query --- //
+type GraphQlAccountResponse struct {
+	Data   Data                   `json:"data"`
+	Errors gqlerror.GraphQlErrors `json:"errors"`
+}
+
+type Data struct {
+	Actor Actor `json:"actor"`
+}
+
+type Actor struct {
+	Accounts []Account `json:"accounts"`
+}
+
+type Account struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+func (r *GraphQlAccountResponse) GetErrors() gqlerror.GraphQlErrors {
+	return r.Errors
+}
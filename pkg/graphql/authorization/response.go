@@ -0,0 +1,67 @@
+package authorization
+
+import "github.com/utr1903/newrelic-tracker-user/pkg/graphql/gqlerror"
+
+// --- GraphQL for authorization query --- //
+type GraphQlAuthorizationResponse struct {
+	Data   Data                   `json:"data"`
+	Errors gqlerror.GraphQlErrors `json:"errors"`
+}
+
+type Data struct {
+	Actor Actor `json:"actor"`
+}
+
+type Actor struct {
+	Organization Organization `json:"organization"`
+}
+
+type Organization struct {
+	AuthorizationManagement AuthorizationManagement `json:"authorizationManagement"`
+}
+
+type AuthorizationManagement struct {
+	AuthenticationDomains AuthenticationDomains `json:"authenticationDomains"`
+}
+
+type AuthenticationDomains struct {
+	NextCursor            *string                `json:"nextCursor"`
+	AuthenticationDomains []AuthenticationDomain `json:"authenticationDomains"`
+}
+
+type AuthenticationDomain struct {
+	Id     string `json:"id"`
+	Groups Groups `json:"groups"`
+}
+
+type Groups struct {
+	NextCursor *string `json:"nextCursor"`
+	Groups     []Group `json:"groups"`
+}
+
+type Group struct {
+	Id          string `json:"id"`
+	DisplayName string `json:"displayName"`
+	Roles       Roles  `json:"roles"`
+}
+
+type Roles struct {
+	NextCursor *string `json:"nextCursor"`
+	Roles      []Role  `json:"roles"`
+}
+
+type Role struct {
+	Id        string `json:"id"`
+	RoleId    string `json:"roleId"`
+	Name      string `json:"name"`
+	AccountId int64  `json:"accountId"`
+	Type      string `json:"type"`
+}
+
+func (r *GraphQlAuthorizationResponse) GetAuthDomains() AuthenticationDomains {
+	return r.Data.Actor.Organization.AuthorizationManagement.AuthenticationDomains
+}
+
+func (r *GraphQlAuthorizationResponse) GetErrors() gqlerror.GraphQlErrors {
+	return r.Errors
+}
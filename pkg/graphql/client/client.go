@@ -0,0 +1,156 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logging "github.com/utr1903/newrelic-tracker-internal/logging"
+	"github.com/utr1903/newrelic-tracker-user/pkg/httpstatus"
+)
+
+const (
+	CLIENT_QUERY_COULD_NOT_BE_SUBSTITUTED           = "query template variables could not be substituted"
+	CLIENT_PAYLOAD_COULD_NOT_BE_CREATED             = "query payload could not be created"
+	CLIENT_REQUEST_COULD_NOT_BE_CREATED             = "query request could not be created"
+	CLIENT_REQUEST_HAS_FAILED                       = "query request has failed"
+	CLIENT_RESPONSE_HAS_RETURNED_NOT_OK_STATUS_CODE = "response has returned not ok status code"
+	CLIENT_RESPONSE_COULD_NOT_BE_PARSED             = "response body could not be parsed"
+	CLIENT_EXECUTING_REQUEST                        = "executing request"
+)
+
+// IGraphQlClient executes a query whose template is substituted with
+// the given variables and parses the response into the given result.
+// The request is cancelled once the context is done.
+type IGraphQlClient interface {
+	Execute(
+		ctx context.Context,
+		queryVariables any,
+		result any,
+	) error
+}
+
+type graphQlRequestPayload struct {
+	Query string `json:"query"`
+}
+
+// GraphQlClient executes the queries of a single template against
+// NerdGraph. Unlike the internal client, it authenticates with the
+// given API key instead of the environment and binds every request
+// to the context of the caller.
+type GraphQlClient struct {
+	Logger            logging.ILogger
+	HttpClient        *http.Client
+	Endpoint          string
+	ApiKey            string
+	QueryTemplateName string
+	QueryTemplate     string
+}
+
+// NewGraphQlClient creates a GraphQL client which authenticates
+// with the given API key.
+func NewGraphQlClient(
+	logger logging.ILogger,
+	newrelicGraphQlEndpoint string,
+	apiKey string,
+	queryTemplateName string,
+	queryTemplate string,
+) *GraphQlClient {
+	return &GraphQlClient{
+		Logger: logger,
+		HttpClient: &http.Client{
+			Timeout: time.Duration(30 * time.Second),
+			Transport: &httpstatus.Transport{
+				Next: http.DefaultTransport,
+			},
+		},
+		Endpoint:          newrelicGraphQlEndpoint,
+		ApiKey:            apiKey,
+		QueryTemplateName: queryTemplateName,
+		QueryTemplate:     queryTemplate,
+	}
+}
+
+func (c *GraphQlClient) Execute(
+	ctx context.Context,
+	queryVariables any,
+	result any,
+) error {
+	c.Logger.LogWithFields(logrus.DebugLevel, CLIENT_EXECUTING_REQUEST,
+		map[string]string{
+			"tracker.package": "pkg.graphql.client",
+			"tracker.file":    "client.go",
+			"tracker.query":   c.QueryTemplateName,
+		})
+
+	payload, err := c.createPayload(queryVariables)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint, payload)
+	if err != nil {
+		return errors.New(CLIENT_REQUEST_COULD_NOT_BE_CREATED + ": " + err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Api-Key", c.ApiKey)
+
+	res, err := c.HttpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", CLIENT_REQUEST_HAS_FAILED, err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("%s: %w", CLIENT_REQUEST_HAS_FAILED, err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return errors.New(CLIENT_RESPONSE_HAS_RETURNED_NOT_OK_STATUS_CODE + ": " + strconv.Itoa(res.StatusCode))
+	}
+
+	err = json.Unmarshal(body, result)
+	if err != nil {
+		return errors.New(CLIENT_RESPONSE_COULD_NOT_BE_PARSED + ": " + err.Error())
+	}
+	return nil
+}
+
+// createPayload substitutes the variables within the query template
+// and returns the JSON body of the request. The variables are not
+// escaped, so string values are quoted either by the template or by
+// the caller, e.g. the cursors.
+func (c *GraphQlClient) createPayload(
+	queryVariables any,
+) (
+	*bytes.Buffer,
+	error,
+) {
+	t, err := template.New(c.QueryTemplateName).Parse(c.QueryTemplate)
+	if err != nil {
+		return nil, errors.New(CLIENT_QUERY_COULD_NOT_BE_SUBSTITUTED + ": " + err.Error())
+	}
+
+	query := new(bytes.Buffer)
+	err = t.Execute(query, queryVariables)
+	if err != nil {
+		return nil, errors.New(CLIENT_QUERY_COULD_NOT_BE_SUBSTITUTED + ": " + err.Error())
+	}
+
+	payload, err := json.Marshal(&graphQlRequestPayload{
+		Query: query.String(),
+	})
+	if err != nil {
+		return nil, errors.New(CLIENT_PAYLOAD_COULD_NOT_BE_CREATED + ": " + err.Error())
+	}
+	return bytes.NewBuffer(payload), nil
+}
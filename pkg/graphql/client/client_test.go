@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/utr1903/newrelic-tracker-user/pkg/httpstatus"
+)
+
+type loggerMock struct{}
+
+func (l *loggerMock) LogWithFields(
+	lvl logrus.Level,
+	msg string,
+	attributes map[string]string,
+) {
+}
+
+func (l *loggerMock) Flush() error {
+	return nil
+}
+
+type queryVariablesMock struct {
+	Cursor string
+}
+
+func Test_QueryIsSentWithApiKey(t *testing.T) {
+	var apiKey string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey = r.Header.Get("Api-Key")
+		body = make([]byte, r.ContentLength)
+		r.Body.Read(body)
+		w.Write([]byte(`{"data": {"cursor": "next"}}`))
+	}))
+	defer server.Close()
+
+	gqlc := NewGraphQlClient(&loggerMock{}, server.URL, "apiKey", "query", `{ cursor: {{ .Cursor }} }`)
+	res := &struct {
+		Data struct {
+			Cursor string `json:"cursor"`
+		} `json:"data"`
+	}{}
+	err := gqlc.Execute(context.Background(), &queryVariablesMock{Cursor: "null"}, res)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "apiKey", apiKey)
+	assert.JSONEq(t, `{"query": "{ cursor: null }"}`, string(body))
+	assert.Equal(t, "next", res.Data.Cursor)
+}
+
+func Test_QuotedVariablesAreNotEscaped(t *testing.T) {
+	gqlc := NewGraphQlClient(&loggerMock{}, "", "apiKey", "query", `{ cursor: {{ .Cursor }} }`)
+
+	payload, err := gqlc.createPayload(&queryVariablesMock{Cursor: `"a+b/c="`})
+
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"query": "{ cursor: \"a+b/c=\" }"}`, payload.String())
+}
+
+func Test_RequestIsCancelledWithContext(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	gqlc := NewGraphQlClient(&loggerMock{}, server.URL, "apiKey", "query", `{}`)
+	err := gqlc.Execute(ctx, nil, &struct{}{})
+
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func Test_RetryableStatusIsReturnedAsStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	gqlc := NewGraphQlClient(&loggerMock{}, server.URL, "apiKey", "query", `{}`)
+	err := gqlc.Execute(context.Background(), nil, &struct{}{})
+
+	var statusErr *httpstatus.StatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusTooManyRequests, statusErr.StatusCode)
+}
@@ -0,0 +1,193 @@
+package gqlerror
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	logging "github.com/utr1903/newrelic-tracker-internal/logging"
+)
+
+var (
+	rateLimitClasses = []string{"TOO_MANY_REQUESTS", "RATE_LIMITED", "RATE_LIMIT_EXCEEDED"}
+	rateLimitPhrases = []string{"rate limit", "too many requests"}
+
+	authClasses = []string{"UNAUTHORIZED", "UNAUTHENTICATED", "FORBIDDEN", "ACCESS_DENIED"}
+	authPhrases = []string{"access denied", "unauthorized", "forbidden", "invalid api key"}
+
+	timeoutClasses = []string{"TIMEOUT", "NRDB_TIMEOUT", "GATEWAY_TIMEOUT"}
+	timeoutPhrases = []string{"timeout", "timed out"}
+)
+
+// IResponse is a GraphQL response which carries errors.
+type IResponse interface {
+	GetErrors() GraphQlErrors
+}
+
+// Location is the position in the query which has caused an error.
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GraphQlError is a single entry of the errors of a GraphQL response.
+type GraphQlError struct {
+	Message    string                 `json:"message"`
+	Locations  []Location             `json:"locations"`
+	Path       []interface{}          `json:"path"`
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+// GetPath returns the path of the errored field joined by dots.
+func (e *GraphQlError) GetPath() string {
+	parts := make([]string, 0, len(e.Path))
+	for _, part := range e.Path {
+		parts = append(parts, fmt.Sprintf("%v", part))
+	}
+	return strings.Join(parts, ".")
+}
+
+// GetErrorClass returns the error class which NerdGraph puts into
+// the extensions or the error code if there is no class.
+func (e *GraphQlError) GetErrorClass() string {
+	for _, key := range []string{"errorClass", "code"} {
+		if val, ok := e.Extensions[key]; ok {
+			return fmt.Sprintf("%v", val)
+		}
+	}
+	return ""
+}
+
+// IsRateLimited returns true if the request was rejected because of
+// too many requests.
+func (e *GraphQlError) IsRateLimited() bool {
+	return e.matches(rateLimitClasses, rateLimitPhrases)
+}
+
+// IsAuthError returns true if the API key is invalid or lacks the
+// permission for the requested field.
+func (e *GraphQlError) IsAuthError() bool {
+	return e.matches(authClasses, authPhrases)
+}
+
+// IsTimeout returns true if the query has timed out on the server.
+func (e *GraphQlError) IsTimeout() bool {
+	return e.matches(timeoutClasses, timeoutPhrases)
+}
+
+func (e *GraphQlError) matches(
+	classes []string,
+	phrases []string,
+) bool {
+	errorClass := strings.ToUpper(e.GetErrorClass())
+	for _, class := range classes {
+		if errorClass == class {
+			return true
+		}
+	}
+
+	message := strings.ToLower(e.Message)
+	for _, phrase := range phrases {
+		if strings.Contains(message, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// GraphQlErrors are the errors of a GraphQL response. They implement
+// error so that callers can inspect them with errors.As.
+type GraphQlErrors []GraphQlError
+
+func (e GraphQlErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		if path := err.GetPath(); path != "" {
+			msgs = append(msgs, path+": "+err.Message)
+			continue
+		}
+		msgs = append(msgs, err.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// UnmarshalJSON parses the errors of a response. Errors which do not
+// follow the GraphQL specification are kept as message.
+func (e *GraphQlErrors) UnmarshalJSON(
+	data []byte,
+) error {
+	var parsed []GraphQlError
+	if err := json.Unmarshal(data, &parsed); err == nil {
+		*e = parsed
+		return nil
+	}
+
+	var single GraphQlError
+	if err := json.Unmarshal(data, &single); err == nil && single.Message != "" {
+		*e = GraphQlErrors{single}
+		return nil
+	}
+
+	var message string
+	if err := json.Unmarshal(data, &message); err != nil {
+		message = string(data)
+	}
+	*e = GraphQlErrors{{Message: message}}
+	return nil
+}
+
+// IsRateLimited returns true if any of the errors is rate limited.
+func (e GraphQlErrors) IsRateLimited() bool {
+	return e.anyMatches((*GraphQlError).IsRateLimited)
+}
+
+// IsAuthError returns true if any of the errors is an auth error.
+func (e GraphQlErrors) IsAuthError() bool {
+	return e.anyMatches((*GraphQlError).IsAuthError)
+}
+
+// IsTimeout returns true if any of the errors is a timeout.
+func (e GraphQlErrors) IsTimeout() bool {
+	return e.anyMatches((*GraphQlError).IsTimeout)
+}
+
+func (e GraphQlErrors) anyMatches(
+	fn func(*GraphQlError) bool,
+) bool {
+	for i := range e {
+		if fn(&e[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check logs every error with structured fields and returns the
+// errors if the response has failed. A response which still carries
+// data is partial and can be used despite its errors.
+func Check(
+	logger logging.ILogger,
+	msg string,
+	attributes map[string]string,
+	errs GraphQlErrors,
+	hasData bool,
+) error {
+	for _, e := range errs {
+		fields := map[string]string{}
+		for key, val := range attributes {
+			fields[key] = val
+		}
+		fields["tracker.error"] = e.Message
+		fields["tracker.error.path"] = e.GetPath()
+		fields["tracker.error.class"] = e.GetErrorClass()
+		fields["tracker.error.partial"] = fmt.Sprintf("%t", hasData)
+
+		logger.LogWithFields(logrus.ErrorLevel, msg, fields)
+	}
+
+	if len(errs) == 0 || hasData {
+		return nil
+	}
+	return errs
+}
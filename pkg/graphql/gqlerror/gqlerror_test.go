@@ -0,0 +1,106 @@
+package gqlerror
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type loggerMock struct {
+	fields []map[string]string
+}
+
+func (l *loggerMock) LogWithFields(
+	lvl logrus.Level,
+	msg string,
+	attributes map[string]string,
+) {
+	l.fields = append(l.fields, attributes)
+}
+
+func (l *loggerMock) Flush() error {
+	return nil
+}
+
+func Test_ErrorsAreParsed(t *testing.T) {
+	res := &struct {
+		Errors GraphQlErrors `json:"errors"`
+	}{}
+	json.Unmarshal([]byte(`{"errors": [{
+		"message": "Access denied",
+		"locations": [{"line": 3, "column": 5}],
+		"path": ["actor", "accounts", 0],
+		"extensions": {"errorClass": "FORBIDDEN"}
+	}]}`), res)
+
+	assert.Equal(t, 1, len(res.Errors))
+	assert.Equal(t, "Access denied", res.Errors[0].Message)
+	assert.Equal(t, []Location{{Line: 3, Column: 5}}, res.Errors[0].Locations)
+	assert.Equal(t, "actor.accounts.0", res.Errors[0].GetPath())
+	assert.Equal(t, "FORBIDDEN", res.Errors[0].GetErrorClass())
+	assert.Equal(t, "actor.accounts.0: Access denied", res.Errors.Error())
+}
+
+func Test_MalformedErrorsAreKeptAsMessage(t *testing.T) {
+	var errs GraphQlErrors
+	err := json.Unmarshal([]byte(`"something went wrong"`), &errs)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(errs))
+	assert.Equal(t, "something went wrong", errs[0].Message)
+}
+
+func Test_NoErrorsAreParsedToNil(t *testing.T) {
+	res := &struct {
+		Errors GraphQlErrors `json:"errors"`
+	}{}
+	json.Unmarshal([]byte(`{"errors": null}`), res)
+
+	assert.Nil(t, res.Errors)
+}
+
+func Test_ErrorsAreClassified(t *testing.T) {
+	rateLimited := GraphQlErrors{{
+		Message:    "Too many requests",
+		Extensions: map[string]interface{}{"errorClass": "TOO_MANY_REQUESTS"},
+	}}
+	assert.True(t, rateLimited.IsRateLimited())
+	assert.False(t, rateLimited.IsAuthError())
+	assert.False(t, rateLimited.IsTimeout())
+
+	auth := GraphQlErrors{{Message: "first"}, {Message: "Access denied"}}
+	assert.True(t, auth.IsAuthError())
+	assert.False(t, auth.IsRateLimited())
+
+	timeout := GraphQlErrors{{
+		Message:    "NRDB query failed",
+		Extensions: map[string]interface{}{"errorClass": "NRDB_TIMEOUT"},
+	}}
+	assert.True(t, timeout.IsTimeout())
+}
+
+func Test_PartialResponseIsNotFailed(t *testing.T) {
+	logger := &loggerMock{}
+	errs := GraphQlErrors{{Message: "first"}, {Message: "second"}}
+
+	err := Check(logger, "msg", map[string]string{"tracker.package": "test"}, errs, true)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(logger.fields))
+	assert.Equal(t, "test", logger.fields[0]["tracker.package"])
+	assert.Equal(t, "true", logger.fields[1]["tracker.error.partial"])
+}
+
+func Test_ResponseWithoutDataIsFailed(t *testing.T) {
+	logger := &loggerMock{}
+	errs := GraphQlErrors{{Message: "first"}}
+
+	err := Check(logger, "msg", map[string]string{}, errs, false)
+
+	var gqlErrs GraphQlErrors
+	assert.True(t, errors.As(err, &gqlErrs))
+	assert.Equal(t, "first", gqlErrs[0].Message)
+}
@@ -1,9 +1,11 @@
 package nrql
 
+import "github.com/utr1903/newrelic-tracker-user/pkg/graphql/gqlerror"
+
 // --- GraphQL for NRQL query --- //
 type GraphQlNrqlResponse[T interface{}] struct {
-	Data   Data[T]     `json:"data"`
-	Errors interface{} `json:"errors"`
+	Data   Data[T]                `json:"data"`
+	Errors gqlerror.GraphQlErrors `json:"errors"`
 }
 
 type Data[T interface{}] struct {
@@ -17,3 +19,7 @@ type Actor[T interface{}] struct {
 type Nrql[T interface{}] struct {
 	Results []T `json:"results"`
 }
+
+func (r *GraphQlNrqlResponse[T]) GetErrors() gqlerror.GraphQlErrors {
+	return r.Errors
+}
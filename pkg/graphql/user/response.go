@@ -1,9 +1,11 @@
 package user
 
+import "github.com/utr1903/newrelic-tracker-user/pkg/graphql/gqlerror"
+
 // --- GraphQL for user query --- //
 type GraphQlUserResponse struct {
-	Data   Data        `json:"data"`
-	Errors interface{} `json:"errors"`
+	Data   Data                   `json:"data"`
+	Errors gqlerror.GraphQlErrors `json:"errors"`
 }
 
 type Data struct {
@@ -28,9 +30,35 @@ type AuthenticationDomains struct {
 }
 
 type AuthenticationDomain struct {
-	Id    string `json:"id"`
-	Name  string `json:"name"`
-	Users Users  `json:"users"`
+	Id                  string              `json:"id"`
+	Name                string              `json:"name"`
+	ProvisioningType    string              `json:"provisioningType"`
+	AuthenticationType  string              `json:"authenticationType"`
+	UserUpgradeSettings UserUpgradeSettings `json:"userUpgradeSettings"`
+	SessionSettings     SessionSettings     `json:"sessionSettings"`
+	Users               Users               `json:"users"`
+	Groups              Groups              `json:"groups"`
+}
+
+type UserUpgradeSettings struct {
+	Mode            string `json:"mode"`
+	DefaultUserType string `json:"defaultUserType"`
+}
+
+type SessionSettings struct {
+	IdleTimeoutMinutes    *int `json:"idleTimeoutMinutes"`
+	SessionTimeoutMinutes *int `json:"sessionTimeoutMinutes"`
+}
+
+type Groups struct {
+	NextCursor *string `json:"nextCursor"`
+	Groups     []Group `json:"groups"`
+}
+
+type Group struct {
+	Id          string `json:"id"`
+	DisplayName string `json:"displayName"`
+	Users       Users  `json:"users"`
 }
 
 type Users struct {
@@ -49,9 +77,14 @@ type User struct {
 }
 
 type UserType struct {
-	Id string `json:"id"`
+	Id          string `json:"id"`
+	DisplayName string `json:"displayName"`
 }
 
 func (r *GraphQlUserResponse) GetAuthDomains() AuthenticationDomains {
 	return r.Data.Actor.Organization.UserManagement.AuthenticationDomains
 }
+
+func (r *GraphQlUserResponse) GetErrors() gqlerror.GraphQlErrors {
+	return r.Errors
+}
@@ -0,0 +1,55 @@
+package httpstatus
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+)
+
+const (
+	HTTPSTATUS_RESPONSE_HAS_RETURNED_RETRYABLE_STATUS_CODE = "response has returned retryable status code"
+)
+
+// StatusError is returned for the responses of the New Relic APIs
+// which are worth retrying.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return HTTPSTATUS_RESPONSE_HAS_RETURNED_RETRYABLE_STATUS_CODE + ": " + strconv.Itoa(e.StatusCode)
+}
+
+// IsRetryable returns true for the rate limits and server errors.
+func IsRetryable(
+	statusCode int,
+) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// Transport returns the rate limits and server errors as StatusError
+// so that they can be retried.
+type Transport struct {
+	Next http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(
+	req *http.Request,
+) (
+	*http.Response,
+	error,
+) {
+	res, err := t.Next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if IsRetryable(res.StatusCode) {
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		return nil, &StatusError{
+			StatusCode: res.StatusCode,
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logging "github.com/utr1903/newrelic-tracker-internal/logging"
+	"github.com/utr1903/newrelic-tracker-user/pkg/httpstatus"
+)
+
+const (
+	METRICS_PAYLOAD_COULD_NOT_BE_CREATED     = "metric payload could not be created"
+	METRICS_REQUEST_COULD_NOT_BE_CREATED     = "metric request could not be created"
+	METRICS_REQUEST_HAS_FAILED               = "metric request has failed"
+	METRICS_NEW_RELIC_RETURNED_NOT_OK_STATUS = "new relic has returned not ok status for metrics"
+	METRICS_ARE_FORWARDED                    = "metrics are forwarded"
+)
+
+type commonBlock struct {
+	Attributes map[string]string `json:"attributes"`
+}
+
+type metricBlock struct {
+	Timestamp  int64             `json:"timestamp"`
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	Value      float64           `json:"value"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+type metricObject struct {
+	Common  *commonBlock  `json:"common"`
+	Metrics []metricBlock `json:"metrics"`
+}
+
+// IMetricForwarder collects metrics and sends them to the New Relic
+// Metric API within the given context.
+type IMetricForwarder interface {
+	AddMetric(
+		metricTimestamp int64,
+		metricName string,
+		metricType string,
+		metricValue float64,
+		metricAttributes map[string]string,
+	)
+	Run(ctx context.Context) error
+}
+
+// MetricForwarder sends the added metrics to the New Relic Metric
+// API. Unlike the internal forwarder, it returns the rate limits and
+// server errors as StatusError so that only those are retried.
+type MetricForwarder struct {
+	Logger           logging.ILogger
+	HttpClient       *http.Client
+	LicenseKey       string
+	Endpoint         string
+	CommonAttributes map[string]string
+
+	metrics []metricBlock
+}
+
+func NewMetricForwarder(
+	logger logging.ILogger,
+	licenseKey string,
+	endpoint string,
+	commonAttributes map[string]string,
+) *MetricForwarder {
+	return &MetricForwarder{
+		Logger: logger,
+		HttpClient: &http.Client{
+			Timeout: time.Duration(30 * time.Second),
+			Transport: &httpstatus.Transport{
+				Next: http.DefaultTransport,
+			},
+		},
+		LicenseKey:       licenseKey,
+		Endpoint:         endpoint,
+		CommonAttributes: commonAttributes,
+		metrics:          []metricBlock{},
+	}
+}
+
+func (mf *MetricForwarder) AddMetric(
+	metricTimestamp int64,
+	metricName string,
+	metricType string,
+	metricValue float64,
+	metricAttributes map[string]string,
+) {
+	mf.metrics = append(mf.metrics, metricBlock{
+		Timestamp:  metricTimestamp,
+		Name:       metricName,
+		Type:       metricType,
+		Value:      metricValue,
+		Attributes: metricAttributes,
+	})
+}
+
+// Run sends the pending metrics. They are removed once they have
+// been accepted so that a repeated run does not send them twice.
+func (mf *MetricForwarder) Run(
+	ctx context.Context,
+) error {
+	if len(mf.metrics) == 0 {
+		return nil
+	}
+
+	payload, err := mf.createPayload()
+	if err != nil {
+		return errors.New(METRICS_PAYLOAD_COULD_NOT_BE_CREATED + ": " + err.Error())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, mf.Endpoint, payload)
+	if err != nil {
+		return errors.New(METRICS_REQUEST_COULD_NOT_BE_CREATED + ": " + err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Api-Key", mf.LicenseKey)
+
+	res, err := mf.HttpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", METRICS_REQUEST_HAS_FAILED, err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.New(METRICS_NEW_RELIC_RETURNED_NOT_OK_STATUS + ": " + strconv.Itoa(res.StatusCode))
+	}
+
+	mf.Logger.LogWithFields(logrus.DebugLevel, METRICS_ARE_FORWARDED,
+		map[string]string{
+			"tracker.package": "pkg.metrics",
+			"tracker.file":    "metrics.go",
+			"tracker.count":   strconv.Itoa(len(mf.metrics)),
+		})
+	mf.metrics = []metricBlock{}
+	return nil
+}
+
+// createPayload returns the gzipped metrics together with the
+// common attributes.
+func (mf *MetricForwarder) createPayload() (
+	*bytes.Buffer,
+	error,
+) {
+	batch, err := json.Marshal([]metricObject{{
+		Common: &commonBlock{
+			Attributes: mf.CommonAttributes,
+		},
+		Metrics: mf.metrics,
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	_, err = zw.Write(batch)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &body, nil
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/utr1903/newrelic-tracker-user/pkg/httpstatus"
+)
+
+type loggerMock struct {
+	msgs []string
+}
+
+func (l *loggerMock) LogWithFields(
+	lvl logrus.Level,
+	msg string,
+	attributes map[string]string,
+) {
+	l.msgs = append(l.msgs, msg)
+}
+
+func (l *loggerMock) Flush() error {
+	return nil
+}
+
+// metricApiMock records the decoded payloads and answers with the
+// given status code.
+type metricApiMock struct {
+	statusCode int
+	payloads   [][]metricObject
+}
+
+func (m *metricApiMock) ServeHTTP(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	zr, _ := gzip.NewReader(r.Body)
+	payload := []metricObject{}
+	json.NewDecoder(zr).Decode(&payload)
+	m.payloads = append(m.payloads, payload)
+	w.WriteHeader(m.statusCode)
+}
+
+func Test_MetricsAreSentOnce(t *testing.T) {
+	api := &metricApiMock{statusCode: http.StatusAccepted}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	mf := NewMetricForwarder(&loggerMock{}, "licenseKey", server.URL, map[string]string{"tracker.organizationId": "org"})
+	mf.AddMetric(1000, "name", "gauge", 2, map[string]string{"a": "1"})
+
+	assert.Nil(t, mf.Run(context.Background()))
+	assert.Nil(t, mf.Run(context.Background()))
+
+	assert.Equal(t, 1, len(api.payloads))
+	assert.Equal(t, "org", api.payloads[0][0].Common.Attributes["tracker.organizationId"])
+	assert.Equal(t, []metricBlock{{
+		Timestamp:  1000,
+		Name:       "name",
+		Type:       "gauge",
+		Value:      2,
+		Attributes: map[string]string{"a": "1"},
+	}}, api.payloads[0][0].Metrics)
+}
+
+func Test_StatusCodesAreClassified(t *testing.T) {
+	for statusCode, retryable := range map[int]bool{
+		http.StatusTooManyRequests:       true,
+		http.StatusServiceUnavailable:    true,
+		http.StatusBadRequest:            false,
+		http.StatusForbidden:             false,
+		http.StatusRequestEntityTooLarge: false,
+	} {
+		server := httptest.NewServer(&metricApiMock{statusCode: statusCode})
+
+		mf := NewMetricForwarder(&loggerMock{}, "licenseKey", server.URL, nil)
+		mf.AddMetric(1000, "name", "gauge", 2, nil)
+		err := mf.Run(context.Background())
+
+		var statusErr *httpstatus.StatusError
+		assert.NotNil(t, err)
+		assert.Equal(t, retryable, errors.As(err, &statusErr), statusCode)
+		server.Close()
+	}
+}
@@ -0,0 +1,171 @@
+package prometheus
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	TYPE_GAUGE   = "gauge"
+	TYPE_COUNTER = "counter"
+)
+
+// DefaultRegistry is shared by the trackers since they are created
+// anew for every run while the exposed values have to outlive them.
+var DefaultRegistry = NewRegistry()
+
+// Sample is a value of a metric family with its labels.
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+type family struct {
+	help    string
+	typ     string
+	samples map[string]*Sample
+}
+
+// Registry keeps the metric families which are exposed in the
+// Prometheus text format. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		families: map[string]*family{},
+	}
+}
+
+// SetGauges replaces all samples of the given gauge family so that
+// the values of a previous run do not linger.
+func (r *Registry) SetGauges(
+	name string,
+	help string,
+	samples []Sample,
+) {
+	f := &family{
+		help:    help,
+		typ:     TYPE_GAUGE,
+		samples: map[string]*Sample{},
+	}
+	for i := range samples {
+		key := encodeLabels(samples[i].Labels)
+		if existing, ok := f.samples[key]; ok {
+			existing.Value += samples[i].Value
+			continue
+		}
+		sample := samples[i]
+		f.samples[key] = &sample
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families[name] = f
+}
+
+// AddCounter increases the sample of the given counter family with
+// the given labels.
+func (r *Registry) AddCounter(
+	name string,
+	help string,
+	labels map[string]string,
+	delta float64,
+) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{
+			help:    help,
+			typ:     TYPE_COUNTER,
+			samples: map[string]*Sample{},
+		}
+		r.families[name] = f
+	}
+
+	key := encodeLabels(labels)
+	sample, ok := f.samples[key]
+	if !ok {
+		sample = &Sample{
+			Labels: labels,
+		}
+		f.samples[key] = sample
+	}
+	sample.Value += delta
+}
+
+// Write writes all families in the text format where the families
+// and their samples are sorted.
+func (r *Registry) Write(
+	w io.Writer,
+) error {
+	var buf bytes.Buffer
+
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := r.families[name]
+		buf.WriteString("# HELP " + name + " " + f.help + "\n")
+		buf.WriteString("# TYPE " + name + " " + f.typ + "\n")
+
+		keys := make([]string, 0, len(f.samples))
+		for key := range f.samples {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			buf.WriteString(name + key + " " + strconv.FormatFloat(f.samples[key].Value, 'g', -1, 64) + "\n")
+		}
+	}
+	r.mu.Unlock()
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// encodeLabels returns the labels as they are written after the
+// metric name, e.g. {a="1",b="2"}.
+func encodeLabels(
+	labels map[string]string,
+) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"=\""+escapeLabelValue(labels[name])+"\"")
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelValueReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+)
+
+func escapeLabelValue(
+	val string,
+) string {
+	return labelValueReplacer.Replace(val)
+}
@@ -0,0 +1,68 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FamiliesAreWrittenInTextFormat(t *testing.T) {
+	r := NewRegistry()
+	r.SetGauges("users", "Number of users.", []Sample{
+		{Labels: map[string]string{"type": "1", "name": "full\"Platform"}, Value: 2},
+		{Labels: map[string]string{"type": "0", "name": "basic"}, Value: 3},
+	})
+	r.AddCounter("audit_total", "Number of audit events.", map[string]string{"action": "a"}, 1)
+	r.AddCounter("audit_total", "Number of audit events.", map[string]string{"action": "a"}, 1)
+
+	var buf bytes.Buffer
+	err := r.Write(&buf)
+
+	assert.Nil(t, err)
+	assert.Equal(t, `# HELP audit_total Number of audit events.
+# TYPE audit_total counter
+audit_total{action="a"} 2
+# HELP users Number of users.
+# TYPE users gauge
+users{name="basic",type="0"} 3
+users{name="full\"Platform",type="1"} 2
+`, buf.String())
+}
+
+func Test_GaugesAreReplaced(t *testing.T) {
+	r := NewRegistry()
+	r.SetGauges("users", "Number of users.", []Sample{
+		{Labels: map[string]string{"type": "1"}, Value: 2},
+	})
+	r.SetGauges("users", "Number of users.", []Sample{
+		{Labels: map[string]string{"type": "0"}, Value: 1},
+	})
+
+	var buf bytes.Buffer
+	r.Write(&buf)
+
+	assert.NotContains(t, buf.String(), `type="1"`)
+	assert.Contains(t, buf.String(), `users{type="0"} 1`)
+}
+
+func Test_ServerExposesRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.AddCounter("audit_total", "Number of audit events.", nil, 1)
+
+	s := NewServer("127.0.0.1:0", r)
+	err := s.Start()
+	assert.Nil(t, err)
+	defer s.Shutdown(context.Background())
+
+	res, err := http.Get("http://" + s.Address() + "/metrics")
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+
+	assert.Equal(t, CONTENT_TYPE, res.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), "audit_total 1")
+}
@@ -0,0 +1,76 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	PROMETHEUS_SERVER_COULD_NOT_BE_STARTED = "prometheus server could not be started"
+)
+
+// CONTENT_TYPE is the content type of the text format.
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+// Server exposes the families of a registry at /metrics.
+type Server struct {
+	server   *http.Server
+	listener net.Listener
+}
+
+func NewServer(
+	address string,
+	registry *Registry,
+) *Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", NewHandler(registry))
+	return &Server{
+		server: &http.Server{
+			Addr:              address,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// NewHandler returns the handler which writes the families of the
+// given registry.
+func NewHandler(
+	registry *Registry,
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", CONTENT_TYPE)
+		registry.Write(w)
+	})
+}
+
+// Start listens on the address and serves the requests in the
+// background.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return errors.New(PROMETHEUS_SERVER_COULD_NOT_BE_STARTED + ": " + err.Error())
+	}
+	s.listener = listener
+
+	go s.server.Serve(listener)
+	return nil
+}
+
+// Address returns the address the server listens on.
+func (s *Server) Address() string {
+	if s.listener == nil {
+		return s.server.Addr
+	}
+	return s.listener.Addr().String()
+}
+
+// Shutdown waits for the in-flight requests to finish.
+func (s *Server) Shutdown(
+	ctx context.Context,
+) error {
+	return s.server.Shutdown(ctx)
+}
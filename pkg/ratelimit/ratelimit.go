@@ -0,0 +1,140 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/utr1903/newrelic-tracker-user/pkg/graphql/client"
+	"github.com/utr1903/newrelic-tracker-user/pkg/tracker"
+)
+
+// Limiter is a token bucket which additionally bounds the number
+// of requests in flight. It is safe for concurrent use and meant to
+// be shared between all clients talking to the same API.
+type Limiter struct {
+	rate     float64
+	burst    float64
+	inFlight chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+	wait   func(context.Context, time.Duration) error
+}
+
+// NewLimiter creates a limiter which allows the given requests per
+// second with a burst of one second worth of requests. A zero rate
+// or max in-flight disables the respective limit.
+func NewLimiter(
+	requestsPerSecond float64,
+	maxInFlight int,
+) *Limiter {
+	l := &Limiter{
+		rate:  requestsPerSecond,
+		burst: math.Max(1, math.Ceil(requestsPerSecond)),
+		now:   time.Now,
+		wait:  tracker.Sleep,
+	}
+	l.tokens = l.burst
+	l.last = l.now()
+
+	if maxInFlight > 0 {
+		l.inFlight = make(chan struct{}, maxInFlight)
+	}
+	return l
+}
+
+// Acquire blocks until a request is allowed and returns the function
+// which has to be called once the request has finished. It fails
+// with the error of the context if the context is done before.
+func (l *Limiter) Acquire(
+	ctx context.Context,
+) (
+	release func(),
+	err error,
+) {
+	if l.inFlight != nil {
+		select {
+		case l.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release = func() {
+		if l.inFlight != nil {
+			<-l.inFlight
+		}
+	}
+
+	err = l.take(ctx)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// take removes a token from the bucket and waits for the next one
+// if the bucket is empty.
+func (l *Limiter) take(
+	ctx context.Context,
+) error {
+	if l.rate <= 0 {
+		return nil
+	}
+
+	for {
+		l.mu.Lock()
+		now := l.now()
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+
+		// Wait until the next token is available
+		delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+		err := l.wait(ctx, delay)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// GraphQlClient passes every request of the wrapped client through
+// the limiter.
+type GraphQlClient struct {
+	Client  client.IGraphQlClient
+	Limiter *Limiter
+}
+
+func NewGraphQlClient(
+	gqlc client.IGraphQlClient,
+	limiter *Limiter,
+) *GraphQlClient {
+	return &GraphQlClient{
+		Client:  gqlc,
+		Limiter: limiter,
+	}
+}
+
+func (c *GraphQlClient) Execute(
+	ctx context.Context,
+	queryVariables any,
+	result any,
+) error {
+	release, err := c.Limiter.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return c.Client.Execute(ctx, queryVariables, result)
+}
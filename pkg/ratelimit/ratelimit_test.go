@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type graphqlClientMock struct {
+	inFlight    int32
+	maxInFlight int32
+	delay       time.Duration
+}
+
+func (c *graphqlClientMock) Execute(
+	ctx context.Context,
+	qv any,
+	result any,
+) error {
+	current := atomic.AddInt32(&c.inFlight, 1)
+	defer atomic.AddInt32(&c.inFlight, -1)
+
+	for {
+		max := atomic.LoadInt32(&c.maxInFlight)
+		if current <= max || atomic.CompareAndSwapInt32(&c.maxInFlight, max, current) {
+			break
+		}
+	}
+	time.Sleep(c.delay)
+	return nil
+}
+
+// newTestLimiter creates a limiter with a fake clock which only
+// advances when the limiter sleeps.
+func newTestLimiter(
+	requestsPerSecond float64,
+	slept *time.Duration,
+) *Limiter {
+	start := time.Unix(0, 0)
+	l := NewLimiter(requestsPerSecond, 0)
+	l.now = func() time.Time {
+		return start.Add(*slept)
+	}
+	l.last = l.now()
+	l.wait = func(ctx context.Context, d time.Duration) error {
+		*slept += d
+		return nil
+	}
+	return l
+}
+
+func Test_BurstIsNotDelayed(t *testing.T) {
+	var slept time.Duration
+	l := newTestLimiter(5, &slept)
+
+	for i := 0; i < 5; i++ {
+		release, err := l.Acquire(context.Background())
+		assert.Nil(t, err)
+		release()
+	}
+
+	assert.Equal(t, time.Duration(0), slept)
+}
+
+func Test_RequestsAreSpreadAccordingToRate(t *testing.T) {
+	var slept time.Duration
+	l := newTestLimiter(2, &slept)
+
+	for i := 0; i < 6; i++ {
+		release, err := l.Acquire(context.Background())
+		assert.Nil(t, err)
+		release()
+	}
+
+	// 2 requests of the burst and 4 more at 2 per second
+	assert.Equal(t, 2*time.Second, slept)
+}
+
+func Test_ZeroRateIsUnlimited(t *testing.T) {
+	var slept time.Duration
+	l := newTestLimiter(0, &slept)
+
+	for i := 0; i < 100; i++ {
+		release, err := l.Acquire(context.Background())
+		assert.Nil(t, err)
+		release()
+	}
+
+	assert.Equal(t, time.Duration(0), slept)
+}
+
+func Test_InFlightRequestsAreBounded(t *testing.T) {
+	gqlc := &graphqlClientMock{
+		delay: 10 * time.Millisecond,
+	}
+	c := NewGraphQlClient(gqlc, NewLimiter(0, 2))
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Execute(context.Background(), nil, nil)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), gqlc.maxInFlight)
+}
+
+func Test_AcquireIsCancelledWithContext(t *testing.T) {
+	l := NewLimiter(1, 1)
+	release, err := l.Acquire(context.Background())
+	assert.Nil(t, err)
+
+	// The only slot is taken
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.Acquire(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// The bucket is empty until a second has passed
+	release()
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.Acquire(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// The slot of the cancelled request has been released
+	assert.Equal(t, 0, len(l.inFlight))
+}
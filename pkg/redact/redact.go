@@ -0,0 +1,140 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+)
+
+const (
+	REDACT_ACTION_IS_UNKNOWN   = "redaction action is unknown"
+	REDACT_HASH_KEY_IS_MISSING = "hash key is missing"
+)
+
+const (
+	ACTION_KEEP = "keep"
+	ACTION_DROP = "drop"
+	ACTION_HASH = "hash"
+	ACTION_MASK = "mask"
+)
+
+// relatedAttributes are the attributes which carry the values of
+// another attribute, e.g. the emails of an email change. They follow
+// the action of that attribute unless they have their own.
+var relatedAttributes = map[string][]string{
+	"tracker.users.email": {
+		"tracker.users.previousEmail",
+		"tracker.users.currentEmail",
+	},
+}
+
+// Redactor applies an action per attribute name. Attributes without
+// an action are kept as they are.
+type Redactor struct {
+	actions map[string]string
+	hashKey []byte
+}
+
+// NewRedactor creates a redactor for the given actions per attribute
+// name. Hashing requires a key so that the hashes cannot be reversed
+// by hashing known values.
+func NewRedactor(
+	hashKey string,
+	actions map[string]string,
+) (
+	*Redactor,
+	error,
+) {
+	problems := make([]string, 0)
+	normalized := make(map[string]string, len(actions))
+	for name, action := range actions {
+		action = strings.ToLower(action)
+		switch action {
+		case ACTION_KEEP, ACTION_DROP, ACTION_MASK:
+		case ACTION_HASH:
+			if hashKey == "" {
+				problems = append(problems, REDACT_HASH_KEY_IS_MISSING+": "+name)
+			}
+		default:
+			problems = append(problems, REDACT_ACTION_IS_UNKNOWN+": "+name+": "+action)
+		}
+		normalized[name] = action
+	}
+	if len(problems) != 0 {
+		sort.Strings(problems)
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+
+	for name, related := range relatedAttributes {
+		action, ok := normalized[name]
+		if !ok {
+			continue
+		}
+		for _, relatedName := range related {
+			if _, ok := normalized[relatedName]; !ok {
+				normalized[relatedName] = action
+			}
+		}
+	}
+
+	return &Redactor{
+		actions: normalized,
+		hashKey: []byte(hashKey),
+	}, nil
+}
+
+// Apply returns a copy of the attributes with the actions applied.
+func (r *Redactor) Apply(
+	attributes map[string]string,
+) map[string]string {
+	if r == nil || len(r.actions) == 0 || attributes == nil {
+		return attributes
+	}
+
+	redacted := make(map[string]string, len(attributes))
+	for name, val := range attributes {
+		switch r.actions[name] {
+		case ACTION_DROP:
+			continue
+		case ACTION_HASH:
+			redacted[name] = r.hash(val)
+		case ACTION_MASK:
+			redacted[name] = mask(val)
+		default:
+			redacted[name] = val
+		}
+	}
+	return redacted
+}
+
+// hash returns the HMAC of the value so that equal values still
+// have equal hashes and can be joined.
+func (r *Redactor) hash(
+	val string,
+) string {
+	if val == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write([]byte(val))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// mask keeps the first character and the domain of an email, e.g.
+// j***@corp.com, or only the first character of other values.
+func mask(
+	val string,
+) string {
+	if val == "" {
+		return ""
+	}
+
+	first := string([]rune(val)[0])
+	if at := strings.LastIndex(val, "@"); at > 0 {
+		return first + "***" + val[at:]
+	}
+	return first + "***"
+}
@@ -0,0 +1,86 @@
+package redact
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ActionsAreApplied(t *testing.T) {
+	r, err := NewRedactor("secret", map[string]string{
+		"email":   "mask",
+		"name":    "drop",
+		"actorId": "HASH",
+		"id":      "keep",
+	})
+	assert.Nil(t, err)
+
+	attributes := map[string]string{
+		"email":   "john.doe@corp.com",
+		"name":    "John Doe",
+		"actorId": "12345",
+		"id":      "1",
+		"other":   "value",
+	}
+	redacted := r.Apply(attributes)
+
+	assert.Equal(t, "j***@corp.com", redacted["email"])
+	assert.NotContains(t, redacted, "name")
+	assert.Equal(t, 64, len(redacted["actorId"]))
+	assert.Equal(t, "1", redacted["id"])
+	assert.Equal(t, "value", redacted["other"])
+
+	// The input is not modified
+	assert.Equal(t, "John Doe", attributes["name"])
+}
+
+func Test_HashesAreJoinableButKeyed(t *testing.T) {
+	r1, _ := NewRedactor("key1", map[string]string{"email": "hash"})
+	r2, _ := NewRedactor("key2", map[string]string{"email": "hash"})
+
+	h1 := r1.Apply(map[string]string{"email": "a@b.com"})["email"]
+	h1Again := r1.Apply(map[string]string{"email": "a@b.com"})["email"]
+	h2 := r2.Apply(map[string]string{"email": "a@b.com"})["email"]
+
+	assert.Equal(t, h1, h1Again)
+	assert.NotEqual(t, h1, h2)
+}
+
+func Test_ValuesWithoutDomainAreMasked(t *testing.T) {
+	assert.Equal(t, "J***", mask("John Doe"))
+	assert.Equal(t, "", mask(""))
+}
+
+func Test_InvalidPolicyFails(t *testing.T) {
+	_, err := NewRedactor("", map[string]string{
+		"email": "hash",
+		"name":  "scramble",
+	})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), REDACT_HASH_KEY_IS_MISSING+": email")
+	assert.Contains(t, err.Error(), REDACT_ACTION_IS_UNKNOWN+": name: scramble")
+}
+
+func Test_NilRedactorKeepsAttributes(t *testing.T) {
+	var r *Redactor
+	attributes := map[string]string{"email": "a@b.com"}
+
+	assert.Equal(t, attributes, r.Apply(attributes))
+}
+
+func Test_RelatedAttributesFollowTheirAction(t *testing.T) {
+	r, _ := NewRedactor("secret", map[string]string{
+		"tracker.users.email":        "hash",
+		"tracker.users.currentEmail": "keep",
+	})
+
+	redacted := r.Apply(map[string]string{
+		"tracker.users.email":         "a@b.com",
+		"tracker.users.previousEmail": "a@b.com",
+		"tracker.users.currentEmail":  "c@d.com",
+	})
+
+	assert.Equal(t, redacted["tracker.users.email"], redacted["tracker.users.previousEmail"])
+	assert.Equal(t, "c@d.com", redacted["tracker.users.currentEmail"])
+}
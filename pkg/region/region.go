@@ -0,0 +1,77 @@
+package region
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	REGION_IS_UNKNOWN = "region is unknown"
+)
+
+const (
+	US      = "US"
+	EU      = "EU"
+	FEDRAMP = "FEDRAMP"
+)
+
+// Endpoints holds the New Relic URLs which the trackers
+// communicate with. The events endpoint is the base of the Event
+// API to which the account ID is appended.
+type Endpoints struct {
+	GraphQl string `json:"graphql" yaml:"graphql"`
+	Logs    string `json:"logs" yaml:"logs"`
+	Metrics string `json:"metrics" yaml:"metrics"`
+	Events  string `json:"events" yaml:"events"`
+}
+
+var regionEndpoints = map[string]Endpoints{
+	US: {
+		GraphQl: "https://api.newrelic.com/graphql",
+		Logs:    "https://log-api.newrelic.com/log/v1",
+		Metrics: "https://metric-api.newrelic.com/metric/v1",
+		Events:  "https://insights-collector.newrelic.com/v1/accounts",
+	},
+	EU: {
+		GraphQl: "https://api.eu.newrelic.com/graphql",
+		Logs:    "https://log-api.eu.newrelic.com/log/v1",
+		Metrics: "https://metric-api.eu.newrelic.com/metric/v1",
+		Events:  "https://insights-collector.eu01.nr-data.net/v1/accounts",
+	},
+	FEDRAMP: {
+		GraphQl: "https://gov-api.newrelic.com/graphql",
+		Logs:    "https://gov-log-api.newrelic.com/log/v1",
+		Metrics: "https://gov-metric-api.newrelic.com/metric/v1",
+		Events:  "https://gov-insights-collector.newrelic.com/v1/accounts",
+	},
+}
+
+// NewEndpoints returns the endpoints of the given region where
+// every non-empty field of the overrides replaces the region default.
+func NewEndpoints(
+	region string,
+	overrides Endpoints,
+) (
+	*Endpoints,
+	error,
+) {
+	endpoints, ok := regionEndpoints[strings.ToUpper(region)]
+	if !ok {
+		return nil, errors.New(REGION_IS_UNKNOWN + ": " + region)
+	}
+
+	if overrides.GraphQl != "" {
+		endpoints.GraphQl = overrides.GraphQl
+	}
+	if overrides.Logs != "" {
+		endpoints.Logs = overrides.Logs
+	}
+	if overrides.Metrics != "" {
+		endpoints.Metrics = overrides.Metrics
+	}
+	if overrides.Events != "" {
+		endpoints.Events = overrides.Events
+	}
+
+	return &endpoints, nil
+}
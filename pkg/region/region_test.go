@@ -0,0 +1,35 @@
+package region
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_UnknownRegionFails(t *testing.T) {
+	endpoints, err := NewEndpoints("APAC", Endpoints{})
+
+	assert.Nil(t, endpoints)
+	assert.NotNil(t, err)
+}
+
+func Test_RegionIsResolvedCaseInsensitive(t *testing.T) {
+	endpoints, err := NewEndpoints("us", Endpoints{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "https://api.newrelic.com/graphql", endpoints.GraphQl)
+	assert.Equal(t, "https://log-api.newrelic.com/log/v1", endpoints.Logs)
+	assert.Equal(t, "https://metric-api.newrelic.com/metric/v1", endpoints.Metrics)
+	assert.Equal(t, "https://insights-collector.newrelic.com/v1/accounts", endpoints.Events)
+}
+
+func Test_OverridesReplaceRegionDefaults(t *testing.T) {
+	endpoints, err := NewEndpoints(EU, Endpoints{
+		GraphQl: "http://localhost:8080/graphql",
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "http://localhost:8080/graphql", endpoints.GraphQl)
+	assert.Equal(t, "https://log-api.eu.newrelic.com/log/v1", endpoints.Logs)
+	assert.Equal(t, "https://metric-api.eu.newrelic.com/metric/v1", endpoints.Metrics)
+}
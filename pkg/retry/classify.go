@@ -0,0 +1,54 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/utr1903/newrelic-tracker-user/pkg/graphql/gqlerror"
+	"github.com/utr1903/newrelic-tracker-user/pkg/httpstatus"
+)
+
+// IsRetryable returns true for the errors which are likely to be
+// transient: rate limits, server errors, timeouts and connections
+// which have been refused, reset or closed early. Cancellations,
+// client errors and any other failure of a request, e.g. an invalid
+// URL or certificate, are not retried.
+func IsRetryable(
+	err error,
+) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	// Rate limits and server errors of NerdGraph and the ingest APIs
+	var statusErr *httpstatus.StatusError
+	if errors.As(err, &statusErr) {
+		return true
+	}
+
+	// Rate limits and timeouts within a GraphQL response
+	var gqlErrs gqlerror.GraphQlErrors
+	if errors.As(err, &gqlErrs) {
+		return gqlErrs.IsRateLimited() || gqlErrs.IsTimeout()
+	}
+
+	// Timeouts, refused or reset connections and truncated responses
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,150 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/utr1903/newrelic-tracker-user/pkg/events"
+	"github.com/utr1903/newrelic-tracker-user/pkg/graphql/client"
+	"github.com/utr1903/newrelic-tracker-user/pkg/graphql/gqlerror"
+	"github.com/utr1903/newrelic-tracker-user/pkg/metrics"
+)
+
+// GraphQlClient retries the failed requests of the wrapped client.
+// Responses which carry rate limit or timeout errors are retried as
+// well.
+type GraphQlClient struct {
+	Client  client.IGraphQlClient
+	Retrier *Retrier
+}
+
+func NewGraphQlClient(
+	gqlc client.IGraphQlClient,
+	retrier *Retrier,
+) *GraphQlClient {
+	return &GraphQlClient{
+		Client:  gqlc,
+		Retrier: retrier,
+	}
+}
+
+func (c *GraphQlClient) Execute(
+	ctx context.Context,
+	queryVariables any,
+	result any,
+) error {
+	attempted := false
+	err := c.Retrier.Do(ctx, "graphql", func() error {
+		// Drop what the previous attempt has parsed
+		if attempted {
+			resetResult(result)
+		}
+		attempted = true
+
+		err := c.Client.Execute(ctx, queryVariables, result)
+		if err != nil {
+			return err
+		}
+
+		if res, ok := result.(gqlerror.IResponse); ok {
+			errs := res.GetErrors()
+			if errs.IsRateLimited() || errs.IsTimeout() {
+				return errs
+			}
+		}
+		return nil
+	})
+
+	// The errors of the last response are left to the caller
+	var gqlErrs gqlerror.GraphQlErrors
+	if errors.As(err, &gqlErrs) {
+		return nil
+	}
+	return err
+}
+
+func resetResult(
+	result any,
+) {
+	val := reflect.ValueOf(result)
+	if val.Kind() != reflect.Pointer || val.IsNil() {
+		return
+	}
+	val.Elem().Set(reflect.Zero(val.Elem().Type()))
+}
+
+// MetricForwarder retries the failed flushes of the wrapped
+// forwarder. The added metrics are kept between the attempts.
+type MetricForwarder struct {
+	Forwarder metrics.IMetricForwarder
+	Retrier   *Retrier
+}
+
+func NewMetricForwarder(
+	forwarder metrics.IMetricForwarder,
+	retrier *Retrier,
+) *MetricForwarder {
+	return &MetricForwarder{
+		Forwarder: forwarder,
+		Retrier:   retrier,
+	}
+}
+
+func (mf *MetricForwarder) AddMetric(
+	metricTimestamp int64,
+	metricName string,
+	metricType string,
+	metricValue float64,
+	metricAttributes map[string]string,
+) {
+	mf.Forwarder.AddMetric(
+		metricTimestamp,
+		metricName,
+		metricType,
+		metricValue,
+		metricAttributes,
+	)
+}
+
+func (mf *MetricForwarder) Run(
+	ctx context.Context,
+) error {
+	return mf.Retrier.Do(ctx, "metrics", func() error {
+		return mf.Forwarder.Run(ctx)
+	})
+}
+
+// EventForwarder retries the failed flushes of the wrapped
+// forwarder. The events which have not been sent are kept between
+// the attempts.
+type EventForwarder struct {
+	Forwarder events.IEventForwarder
+	Retrier   *Retrier
+}
+
+func NewEventForwarder(
+	forwarder events.IEventForwarder,
+	retrier *Retrier,
+) *EventForwarder {
+	return &EventForwarder{
+		Forwarder: forwarder,
+		Retrier:   retrier,
+	}
+}
+
+func (ef *EventForwarder) AddEvent(
+	eventType string,
+	timestamp int64,
+	attributes map[string]string,
+) {
+	ef.Forwarder.AddEvent(eventType, timestamp, attributes)
+}
+
+func (ef *EventForwarder) Run(
+	ctx context.Context,
+) error {
+	return ef.Retrier.Do(ctx, "events", func() error {
+		return ef.Forwarder.Run(ctx)
+	})
+}
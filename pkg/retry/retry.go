@@ -0,0 +1,149 @@
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logging "github.com/utr1903/newrelic-tracker-internal/logging"
+	"github.com/utr1903/newrelic-tracker-user/pkg/config"
+	"github.com/utr1903/newrelic-tracker-user/pkg/tracker"
+)
+
+const (
+	RETRY_ATTEMPT_HAS_FAILED      = "attempt has failed, retrying"
+	RETRY_ATTEMPTS_ARE_EXHAUSTED  = "retry attempts are exhausted"
+	RETRY_ERROR_IS_NOT_RETRYABLE  = "error is not retryable"
+	RETRY_OPERATION_HAS_RECOVERED = "operation has recovered after retrying"
+)
+
+// Policy defines how often and how long apart an operation is
+// attempted.
+type Policy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+func NewPolicy(
+	cfg config.Retry,
+) Policy {
+	return Policy{
+		MaxAttempts:    cfg.MaxAttempts,
+		InitialBackoff: cfg.InitialBackoff.Duration(),
+		MaxBackoff:     cfg.MaxBackoff.Duration(),
+	}
+}
+
+// Backoff returns the delay before the given attempt. The delay is
+// doubled with every attempt and half of it is randomized so that
+// concurrent workers do not retry at the same time.
+func (p Policy) Backoff(
+	attempt int,
+	random func(time.Duration) time.Duration,
+) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 2; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff/2 + random(backoff/2)
+}
+
+// Retrier attempts operations according to its policy and reports
+// the retries to the tracker logs.
+type Retrier struct {
+	Policy Policy
+	Logger logging.ILogger
+	wait   func(context.Context, time.Duration) error
+	random func(time.Duration) time.Duration
+}
+
+func NewRetrier(
+	logger logging.ILogger,
+	policy Policy,
+) *Retrier {
+	return &Retrier{
+		Policy: policy,
+		Logger: logger,
+		wait:   tracker.Sleep,
+		random: randomDuration,
+	}
+}
+
+func randomDuration(
+	max time.Duration,
+) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// Do runs the given function until it succeeds, fails with an error
+// which is not retryable, the attempts are exhausted or the context
+// is done while backing off.
+func (r *Retrier) Do(
+	ctx context.Context,
+	operation string,
+	fn func() error,
+) error {
+	attempt := 1
+	for {
+		err := fn()
+		if err == nil {
+			if attempt > 1 {
+				r.log(logrus.DebugLevel, RETRY_OPERATION_HAS_RECOVERED, operation, attempt, nil, 0)
+			}
+			return nil
+		}
+
+		if !IsRetryable(err) {
+			if attempt > 1 {
+				r.log(logrus.ErrorLevel, RETRY_ERROR_IS_NOT_RETRYABLE, operation, attempt, err, 0)
+			}
+			return err
+		}
+
+		if attempt >= r.Policy.MaxAttempts {
+			r.log(logrus.ErrorLevel, RETRY_ATTEMPTS_ARE_EXHAUSTED, operation, attempt, err, 0)
+			return err
+		}
+
+		backoff := r.Policy.Backoff(attempt+1, r.random)
+		r.log(logrus.DebugLevel, RETRY_ATTEMPT_HAS_FAILED, operation, attempt, err, backoff)
+		err = r.wait(ctx, backoff)
+		if err != nil {
+			return err
+		}
+		attempt++
+	}
+}
+
+func (r *Retrier) log(
+	lvl logrus.Level,
+	msg string,
+	operation string,
+	attempt int,
+	err error,
+	backoff time.Duration,
+) {
+	fields := map[string]string{
+		"tracker.package":           "pkg.retry",
+		"tracker.file":              "retry.go",
+		"tracker.retry.operation":   operation,
+		"tracker.retry.attempt":     strconv.Itoa(attempt),
+		"tracker.retry.maxAttempts": strconv.Itoa(r.Policy.MaxAttempts),
+	}
+	if err != nil {
+		fields["tracker.error"] = err.Error()
+	}
+	if backoff > 0 {
+		fields["tracker.retry.backoff"] = backoff.String()
+	}
+	r.Logger.LogWithFields(lvl, msg, fields)
+}
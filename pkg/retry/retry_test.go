@@ -0,0 +1,269 @@
+package retry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/utr1903/newrelic-tracker-user/pkg/graphql/gqlerror"
+	"github.com/utr1903/newrelic-tracker-user/pkg/graphql/user"
+	"github.com/utr1903/newrelic-tracker-user/pkg/httpstatus"
+	"github.com/utr1903/newrelic-tracker-user/pkg/metrics"
+)
+
+type loggerMock struct {
+	msgs []string
+}
+
+func (l *loggerMock) LogWithFields(
+	lvl logrus.Level,
+	msg string,
+	attributes map[string]string,
+) {
+	l.msgs = append(l.msgs, msg)
+}
+
+func (l *loggerMock) Flush() error {
+	return nil
+}
+
+// graphqlClientMock returns the responses in the given order.
+type graphqlClientMock struct {
+	responses []string
+	errs      []error
+	calls     int
+}
+
+func (c *graphqlClientMock) Execute(
+	ctx context.Context,
+	qv any,
+	result any,
+) error {
+	i := c.calls
+	c.calls++
+	if c.errs[i] != nil {
+		return c.errs[i]
+	}
+	err := json.Unmarshal([]byte(c.responses[i]), result)
+	if err != nil {
+		panic(err)
+	}
+	return nil
+}
+
+type metricForwarderMock struct {
+	errs    []error
+	calls   int
+	metrics int
+}
+
+func (mf *metricForwarderMock) AddMetric(
+	metricTimestamp int64,
+	metricName string,
+	metricType string,
+	metricValue float64,
+	metricAttributes map[string]string,
+) {
+	mf.metrics++
+}
+
+func (mf *metricForwarderMock) Run(
+	ctx context.Context,
+) error {
+	err := mf.errs[mf.calls]
+	mf.calls++
+	return err
+}
+
+func newTestRetrier(
+	logger *loggerMock,
+	maxAttempts int,
+	sleeps *[]time.Duration,
+) *Retrier {
+	r := NewRetrier(logger, Policy{
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: time.Second,
+		MaxBackoff:     3 * time.Second,
+	})
+	r.wait = func(ctx context.Context, d time.Duration) error {
+		*sleeps = append(*sleeps, d)
+		return nil
+	}
+	r.random = func(max time.Duration) time.Duration {
+		return max
+	}
+	return r
+}
+
+func Test_BackoffGrowsUpToMax(t *testing.T) {
+	policy := Policy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     3 * time.Second,
+	}
+	none := func(time.Duration) time.Duration { return 0 }
+
+	assert.Equal(t, 500*time.Millisecond, policy.Backoff(2, none))
+	assert.Equal(t, time.Second, policy.Backoff(3, none))
+	assert.Equal(t, 1500*time.Millisecond, policy.Backoff(4, none))
+	assert.Equal(t, 1500*time.Millisecond, policy.Backoff(10, none))
+}
+
+func Test_ErrorsAreClassified(t *testing.T) {
+	assert.True(t, IsRetryable(&url.Error{Op: "Post", Err: &httpstatus.StatusError{StatusCode: 503}}))
+	assert.True(t, IsRetryable(&url.Error{Op: "Post", Err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}))
+	assert.True(t, IsRetryable(&url.Error{Op: "Post", Err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}))
+	assert.True(t, IsRetryable(&url.Error{Op: "Post", Err: io.ErrUnexpectedEOF}))
+	assert.True(t, IsRetryable(&url.Error{Op: "Post", Err: &net.DNSError{IsTimeout: true}}))
+	assert.False(t, IsRetryable(&url.Error{Op: "Post", Err: &net.DNSError{IsNotFound: true}}))
+	assert.False(t, IsRetryable(&url.Error{Op: "Post", Err: errors.New("unsupported protocol scheme")}))
+	assert.True(t, IsRetryable(fmt.Errorf("%s: %w", metrics.METRICS_REQUEST_HAS_FAILED, &url.Error{Op: "Post", Err: &httpstatus.StatusError{StatusCode: 429}})))
+	assert.False(t, IsRetryable(errors.New(metrics.METRICS_NEW_RELIC_RETURNED_NOT_OK_STATUS+": 403")))
+	assert.True(t, IsRetryable(gqlerror.GraphQlErrors{{Message: "Too many requests"}}))
+	assert.False(t, IsRetryable(gqlerror.GraphQlErrors{{Message: "Access denied"}}))
+	assert.False(t, IsRetryable(errors.New("response has returned not ok status code")))
+	assert.False(t, IsRetryable(nil))
+}
+
+func Test_MetricApiStatusCodesAreClassified(t *testing.T) {
+	for statusCode, retryable := range map[int]bool{
+		http.StatusTooManyRequests:       true,
+		http.StatusServiceUnavailable:    true,
+		http.StatusBadRequest:            false,
+		http.StatusForbidden:             false,
+		http.StatusRequestEntityTooLarge: false,
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(statusCode)
+		}))
+
+		mf := metrics.NewMetricForwarder(&loggerMock{}, "licenseKey", server.URL, nil)
+		mf.AddMetric(1000, "name", "gauge", 2, nil)
+		err := mf.Run(context.Background())
+
+		assert.NotNil(t, err)
+		assert.Equal(t, retryable, IsRetryable(err), statusCode)
+		server.Close()
+	}
+}
+
+func Test_TransientFailureIsRetried(t *testing.T) {
+	logger := &loggerMock{}
+	sleeps := []time.Duration{}
+	gqlc := &graphqlClientMock{
+		responses: []string{"", `{"data": {"actor": {"organization": {"userManagement": {"authenticationDomains": {"authenticationDomains": [{"id": "dom1"}]}}}}}}`},
+		errs:      []error{&url.Error{Op: "Post", Err: &httpstatus.StatusError{StatusCode: 502}}, nil},
+	}
+
+	res := &user.GraphQlUserResponse{}
+	err := NewGraphQlClient(gqlc, newTestRetrier(logger, 3, &sleeps)).Execute(context.Background(), nil, res)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, gqlc.calls)
+	assert.Equal(t, []time.Duration{time.Second}, sleeps)
+	assert.Equal(t, "dom1", res.GetAuthDomains().AuthenticationDomains[0].Id)
+	assert.Contains(t, logger.msgs, RETRY_ATTEMPT_HAS_FAILED)
+	assert.Contains(t, logger.msgs, RETRY_OPERATION_HAS_RECOVERED)
+}
+
+func Test_PermanentFailureIsNotRetried(t *testing.T) {
+	logger := &loggerMock{}
+	sleeps := []time.Duration{}
+	gqlc := &graphqlClientMock{
+		errs: []error{errors.New("response has returned not ok status code")},
+	}
+
+	err := NewGraphQlClient(gqlc, newTestRetrier(logger, 3, &sleeps)).Execute(context.Background(), nil, &user.GraphQlUserResponse{})
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, gqlc.calls)
+	assert.Empty(t, sleeps)
+}
+
+func Test_RateLimitedResponseIsRetriedAndReset(t *testing.T) {
+	logger := &loggerMock{}
+	sleeps := []time.Duration{}
+	gqlc := &graphqlClientMock{
+		responses: []string{
+			`{"errors": [{"message": "Too many requests", "extensions": {"errorClass": "TOO_MANY_REQUESTS"}}]}`,
+			`{"data": {"actor": {"organization": {"userManagement": {"authenticationDomains": {"authenticationDomains": []}}}}}}`,
+		},
+		errs: []error{nil, nil},
+	}
+
+	res := &user.GraphQlUserResponse{}
+	err := NewGraphQlClient(gqlc, newTestRetrier(logger, 3, &sleeps)).Execute(context.Background(), nil, res)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, gqlc.calls)
+	assert.Nil(t, res.Errors)
+}
+
+func Test_ExhaustedRateLimitIsLeftToCaller(t *testing.T) {
+	logger := &loggerMock{}
+	sleeps := []time.Duration{}
+	rateLimited := `{"errors": [{"message": "Too many requests"}]}`
+	gqlc := &graphqlClientMock{
+		responses: []string{rateLimited, rateLimited},
+		errs:      []error{nil, nil},
+	}
+
+	res := &user.GraphQlUserResponse{}
+	err := NewGraphQlClient(gqlc, newTestRetrier(logger, 2, &sleeps)).Execute(context.Background(), nil, res)
+
+	assert.Nil(t, err)
+	assert.True(t, res.Errors.IsRateLimited())
+	assert.Contains(t, logger.msgs, RETRY_ATTEMPTS_ARE_EXHAUSTED)
+}
+
+func Test_MetricsAreFlushedAgain(t *testing.T) {
+	logger := &loggerMock{}
+	sleeps := []time.Duration{}
+	notOk := &httpstatus.StatusError{StatusCode: 503}
+	mfMock := &metricForwarderMock{
+		errs: []error{notOk, notOk, notOk},
+	}
+
+	mf := NewMetricForwarder(mfMock, newTestRetrier(logger, 3, &sleeps))
+	mf.AddMetric(0, "name", "gauge", 1, nil)
+	err := mf.Run(context.Background())
+
+	assert.Equal(t, notOk, err)
+	assert.Equal(t, 3, mfMock.calls)
+	assert.Equal(t, 1, mfMock.metrics)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, sleeps)
+}
+
+func Test_BackoffIsCancelledWithContext(t *testing.T) {
+	logger := &loggerMock{}
+	notOk := &httpstatus.StatusError{StatusCode: 503}
+	mfMock := &metricForwarderMock{
+		errs: []error{notOk, notOk},
+	}
+
+	r := NewRetrier(logger, Policy{
+		MaxAttempts:    2,
+		InitialBackoff: time.Hour,
+		MaxBackoff:     time.Hour,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := NewMetricForwarder(mfMock, r).Run(ctx)
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 1, mfMock.calls)
+}
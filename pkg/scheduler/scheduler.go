@@ -0,0 +1,143 @@
+package scheduler
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Job is a task which is run periodically by the scheduler.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Jitter   time.Duration
+	Run      func() error
+}
+
+// Result is reported after every run of a job. Skipped is set
+// when the run was not started because the previous one was
+// still in progress.
+type Result struct {
+	Name    string
+	Err     error
+	Skipped bool
+}
+
+type Scheduler struct {
+	jobs     []Job
+	onResult func(Result)
+	random   func(time.Duration) time.Duration
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+func NewScheduler(
+	jobs []Job,
+	onResult func(Result),
+) *Scheduler {
+	return &Scheduler{
+		jobs:     jobs,
+		onResult: onResult,
+		random:   randomDuration,
+	}
+}
+
+func randomDuration(
+	max time.Duration,
+) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// Start runs every job immediately and then on its interval until
+// the given context is cancelled. It returns after all in-flight
+// runs have finished.
+func (s *Scheduler) Start(
+	ctx context.Context,
+) {
+	loops := new(sync.WaitGroup)
+	for _, job := range s.jobs {
+		loops.Add(1)
+		go func(job Job) {
+			defer loops.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+	loops.Wait()
+
+	// Let the in-flight runs finish
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(
+	ctx context.Context,
+	job Job,
+) {
+	var running int32
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	s.trigger(ctx, job, &running)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.trigger(ctx, job, &running)
+		}
+	}
+}
+
+func (s *Scheduler) trigger(
+	ctx context.Context,
+	job Job,
+	running *int32,
+) {
+	// Prevent overlapping runs of the same job
+	if !atomic.CompareAndSwapInt32(running, 0, 1) {
+		s.report(Result{
+			Name:    job.Name,
+			Skipped: true,
+		})
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer atomic.StoreInt32(running, 0)
+
+		// Wait for the jitter unless shutting down
+		timer := time.NewTimer(s.random(job.Jitter))
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		err := job.Run()
+		s.report(Result{
+			Name: job.Name,
+			Err:  err,
+		})
+	}()
+}
+
+func (s *Scheduler) report(
+	result Result,
+) {
+	if s.onResult == nil {
+		return
+	}
+
+	// Results are reported one at a time
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onResult(result)
+}
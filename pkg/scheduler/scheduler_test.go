@@ -0,0 +1,126 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type resultsMock struct {
+	mu      sync.Mutex
+	results []Result
+}
+
+func (r *resultsMock) add(
+	result Result,
+) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, result)
+}
+
+func (r *resultsMock) count(
+	skipped bool,
+) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for _, result := range r.results {
+		if result.Skipped == skipped {
+			count++
+		}
+	}
+	return count
+}
+
+func Test_JobRunsPeriodically(t *testing.T) {
+	results := &resultsMock{}
+	s := NewScheduler([]Job{
+		{
+			Name:     "job",
+			Interval: 10 * time.Millisecond,
+			Run: func() error {
+				return errors.New("error_run")
+			},
+		},
+	}, results.add)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 55*time.Millisecond)
+	defer cancel()
+	s.Start(ctx)
+
+	assert.GreaterOrEqual(t, results.count(false), 3)
+	assert.Equal(t, "error_run", results.results[0].Err.Error())
+}
+
+func Test_OverlappingRunIsSkipped(t *testing.T) {
+	results := &resultsMock{}
+	s := NewScheduler([]Job{
+		{
+			Name:     "job",
+			Interval: 10 * time.Millisecond,
+			Run: func() error {
+				time.Sleep(35 * time.Millisecond)
+				return nil
+			},
+		},
+	}, results.add)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	s.Start(ctx)
+
+	assert.Equal(t, 1, results.count(false))
+	assert.GreaterOrEqual(t, results.count(true), 1)
+}
+
+func Test_ShutdownWaitsForInFlightRuns(t *testing.T) {
+	finished := false
+	s := NewScheduler([]Job{
+		{
+			Name:     "job",
+			Interval: time.Hour,
+			Run: func() error {
+				time.Sleep(20 * time.Millisecond)
+				finished = true
+				return nil
+			},
+		},
+	}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		cancel()
+	}()
+	s.Start(ctx)
+
+	assert.True(t, finished)
+}
+
+func Test_RunIsDelayedByJitter(t *testing.T) {
+	results := &resultsMock{}
+	s := NewScheduler([]Job{
+		{
+			Name:     "job",
+			Interval: time.Hour,
+			Jitter:   time.Hour,
+			Run: func() error {
+				return nil
+			},
+		},
+	}, results.add)
+	s.random = func(max time.Duration) time.Duration {
+		return max
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	s.Start(ctx)
+
+	assert.Equal(t, 0, results.count(false))
+}
@@ -0,0 +1,149 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// writeMu serializes the writes of the local sinks since the
+// trackers share the standard output and possibly the files.
+var writeMu sync.Mutex
+
+// Stdout prints the records in a human readable form. The records
+// are only printed once the tracker has saved its state since the
+// records of a failed run are fetched and written again.
+type Stdout struct {
+	Writer io.Writer
+	now    func() time.Time
+
+	pending bytes.Buffer
+}
+
+func NewStdout() *Stdout {
+	return &Stdout{
+		Writer: os.Stdout,
+		now:    time.Now,
+	}
+}
+
+// Write formats a line per record followed by its attributes in
+// alphabetical order.
+func (s *Stdout) Write(
+	ctx context.Context,
+	records []Record,
+) error {
+	buf := &s.pending
+	for _, record := range records {
+		ts := time.UnixMilli(withTimestamp(record, s.now).Timestamp).UTC()
+		buf.WriteString(ts.Format(time.RFC3339))
+		buf.WriteString(" " + record.Kind + " " + record.Name)
+		if record.Kind == KIND_METRIC {
+			buf.WriteString(" " + strconv.FormatFloat(record.Value, 'f', -1, 64))
+		}
+		buf.WriteByte('\n')
+
+		keys := make([]string, 0, len(record.Attributes))
+		for key := range record.Attributes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			buf.WriteString("  " + key + ": " + record.Attributes[key] + "\n")
+		}
+	}
+	return nil
+}
+
+// Commit prints the written records.
+func (s *Stdout) Commit() error {
+	if s.pending.Len() == 0 {
+		return nil
+	}
+	defer s.pending.Reset()
+
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	_, err := s.Writer.Write(s.pending.Bytes())
+	if err != nil {
+		return errors.New(SINK_OUTPUT_COULD_NOT_BE_WRITTEN + ": " + err.Error())
+	}
+	return nil
+}
+
+// File appends the records as newline delimited JSON to the file
+// at the given path which is created if it does not exist. Like for
+// the standard output, the records are only appended once the
+// tracker has saved its state.
+type File struct {
+	Path string
+	now  func() time.Time
+
+	pending bytes.Buffer
+}
+
+func NewFile(
+	path string,
+) *File {
+	return &File{
+		Path: path,
+		now:  time.Now,
+	}
+}
+
+func (s *File) Write(
+	ctx context.Context,
+	records []Record,
+) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, record := range records {
+		err := enc.Encode(withTimestamp(record, s.now))
+		if err != nil {
+			return errors.New(SINK_RECORDS_COULD_NOT_BE_ENCODED + ": " + err.Error())
+		}
+	}
+	s.pending.Write(buf.Bytes())
+	return nil
+}
+
+// Commit appends the written records to the file.
+func (s *File) Commit() error {
+	if s.pending.Len() == 0 {
+		return nil
+	}
+	defer s.pending.Reset()
+
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.New(SINK_FILE_COULD_NOT_BE_OPENED + ": " + err.Error())
+	}
+	defer f.Close()
+
+	_, err = f.Write(s.pending.Bytes())
+	if err != nil {
+		return errors.New(SINK_OUTPUT_COULD_NOT_BE_WRITTEN + ": " + err.Error())
+	}
+	return nil
+}
+
+// withTimestamp sets the timestamp of the record in milliseconds
+// if it has none.
+func withTimestamp(
+	record Record,
+	now func() time.Time,
+) Record {
+	if record.Timestamp == 0 {
+		record.Timestamp = now().UnixMilli()
+	}
+	return record
+}
@@ -0,0 +1,100 @@
+package sink
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logging "github.com/utr1903/newrelic-tracker-internal/logging"
+	"github.com/utr1903/newrelic-tracker-user/pkg/events"
+	"github.com/utr1903/newrelic-tracker-user/pkg/metrics"
+	"github.com/utr1903/newrelic-tracker-user/pkg/tracker"
+)
+
+// NewRelic forwards the metrics to the Metric API, the events to
+// the Event API and the logs to the Log API. A forwarder is only
+// required for the kinds of records which are written.
+type NewRelic struct {
+	MetricForwarder metrics.IMetricForwarder
+	EventForwarder  events.IEventForwarder
+	Logger          logging.ILogger
+}
+
+func NewNewRelic(
+	metricForwarder metrics.IMetricForwarder,
+	eventForwarder events.IEventForwarder,
+	logger logging.ILogger,
+) *NewRelic {
+	return &NewRelic{
+		MetricForwarder: metricForwarder,
+		EventForwarder:  eventForwarder,
+		Logger:          logger,
+	}
+}
+
+func (s *NewRelic) Write(
+	ctx context.Context,
+	records []Record,
+) error {
+	metrics := make([]Record, 0)
+	events := make([]Record, 0)
+	logs := make([]Record, 0)
+	for _, record := range records {
+		switch record.Kind {
+		case KIND_METRIC:
+			metrics = append(metrics, record)
+		case KIND_EVENT:
+			events = append(events, record)
+		case KIND_LOG:
+			logs = append(logs, record)
+		default:
+			return errKindIsNotSupported(record.Kind)
+		}
+	}
+
+	if len(metrics) != 0 {
+		if s.MetricForwarder == nil {
+			return errKindIsNotSupported(KIND_METRIC)
+		}
+		for _, metric := range metrics {
+			// Metrics without a timestamp are sent as of now
+			if metric.Timestamp == 0 {
+				metric.Timestamp = time.Now().UnixMicro()
+			}
+			s.MetricForwarder.AddMetric(metric.Timestamp, metric.Name, "gauge", metric.Value, metric.Attributes)
+		}
+		err := s.MetricForwarder.Run(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(events) != 0 {
+		if s.EventForwarder == nil {
+			return errKindIsNotSupported(KIND_EVENT)
+		}
+		for _, event := range events {
+			s.EventForwarder.AddEvent(event.Name, event.Timestamp, event.Attributes)
+		}
+		err := s.EventForwarder.Run(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(logs) != 0 {
+		if s.Logger == nil {
+			return errKindIsNotSupported(KIND_LOG)
+		}
+		for _, log := range logs {
+			s.Logger.LogWithFields(logrus.InfoLevel, log.Name, log.Attributes)
+		}
+		// The log forwarder cannot be cancelled
+		err := tracker.Await(ctx, s.Logger.Flush)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package sink
+
+import (
+	"context"
+
+	"github.com/utr1903/newrelic-tracker-user/pkg/prometheus"
+)
+
+// prometheusFamily maps the records of a metric to a Prometheus
+// family where the labels are taken from the given attributes.
+type prometheusFamily struct {
+	name   string
+	help   string
+	labels map[string]string
+}
+
+func (f *prometheusFamily) createLabels(
+	attributes map[string]string,
+) map[string]string {
+	labels := make(map[string]string, len(f.labels))
+	for attribute, label := range f.labels {
+		labels[label] = attributes[attribute]
+	}
+	return labels
+}
+
+// prometheusGauges are the aggregated user counts. The metrics per
+// user are not exposed since their cardinality is too high.
+var prometheusGauges = map[string]prometheusFamily{
+	"tracker.users.type.count": {
+		name: "newrelic_tracker_users_type_count",
+		help: "Number of users per user type.",
+		labels: map[string]string{
+			"tracker.users.type":     "type",
+			"tracker.users.typeName": "type_name",
+		},
+	},
+	"tracker.users.authDomain.count": {
+		name: "newrelic_tracker_users_auth_domain_count",
+		help: "Number of users per authentication domain and user type.",
+		labels: map[string]string{
+			"tracker.users.authDomainId": "auth_domain_id",
+			"tracker.users.type":         "type",
+			"tracker.users.typeName":     "type_name",
+		},
+	},
+	"tracker.users.activity.count": {
+		name: "newrelic_tracker_users_activity_count",
+		help: "Number of users per user type and activity bucket.",
+		labels: map[string]string{
+			"tracker.users.type":     "type",
+			"tracker.users.typeName": "type_name",
+			"tracker.users.activity": "activity",
+		},
+	},
+}
+
+// prometheusAuditCounter counts the audit events whether they are
+// written as metrics or as custom events.
+var prometheusAuditCounter = prometheusFamily{
+	name: "newrelic_tracker_users_audit_events_total",
+	help: "Number of audit events per action identifier and actor type.",
+	labels: map[string]string{
+		"tracker.users.audit.actionIdentifier": "action_identifier",
+		"tracker.users.audit.actorType":        "actor_type",
+	},
+}
+
+// Prometheus exposes the aggregated user counts and the audit event
+// counters through the given registry. The user counts are replaced
+// with every run. The audit event counters are only increased once
+// the tracker has saved its checkpoints since the events of a failed
+// run are fetched and written again.
+type Prometheus struct {
+	Registry       *prometheus.Registry
+	AuditEventType string
+
+	pending []map[string]string
+}
+
+func NewPrometheus(
+	registry *prometheus.Registry,
+	auditEventType string,
+) *Prometheus {
+	return &Prometheus{
+		Registry:       registry,
+		AuditEventType: auditEventType,
+	}
+}
+
+func (s *Prometheus) Write(
+	ctx context.Context,
+	records []Record,
+) error {
+	gauges := map[string][]prometheus.Sample{}
+	for _, record := range records {
+		if s.isAuditEvent(record) {
+			s.pending = append(s.pending, prometheusAuditCounter.createLabels(record.Attributes))
+			continue
+		}
+
+		if record.Kind != KIND_METRIC {
+			continue
+		}
+		if family, ok := prometheusGauges[record.Name]; ok {
+			gauges[record.Name] = append(gauges[record.Name], prometheus.Sample{
+				Labels: family.createLabels(record.Attributes),
+				Value:  record.Value,
+			})
+		}
+	}
+
+	for name, samples := range gauges {
+		family := prometheusGauges[name]
+		s.Registry.SetGauges(family.name, family.help, samples)
+	}
+	return nil
+}
+
+// Commit increases the audit event counters by the written events.
+func (s *Prometheus) Commit() error {
+	for _, labels := range s.pending {
+		s.Registry.AddCounter(
+			prometheusAuditCounter.name,
+			prometheusAuditCounter.help,
+			labels,
+			1,
+		)
+	}
+	s.pending = nil
+	return nil
+}
+
+func (s *Prometheus) isAuditEvent(
+	record Record,
+) bool {
+	switch record.Kind {
+	case KIND_METRIC:
+		return record.Name == "tracker.users.audit.value"
+	case KIND_EVENT:
+		return record.Name == s.AuditEventType
+	default:
+		return false
+	}
+}
@@ -0,0 +1,218 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	flush "github.com/utr1903/newrelic-tracker-internal/flush"
+	"github.com/utr1903/newrelic-tracker-user/pkg/config"
+	"github.com/utr1903/newrelic-tracker-user/pkg/prometheus"
+	"github.com/utr1903/newrelic-tracker-user/pkg/redact"
+)
+
+const (
+	SINK_KIND_IS_NOT_SUPPORTED         = "record kind is not supported by sink"
+	SINK_FILE_COULD_NOT_BE_OPENED      = "sink file could not be opened"
+	SINK_RECORDS_COULD_NOT_BE_ENCODED  = "records could not be encoded"
+	SINK_OUTPUT_COULD_NOT_BE_WRITTEN   = "sink output could not be written"
+	SINK_SINKS_COULD_NOT_WRITE_RECORDS = "sinks could not write records"
+)
+
+// Kinds of the records which the trackers produce. Metrics are
+// numeric values, events are records of a custom event type and
+// logs are records which are forwarded as log lines.
+const (
+	KIND_METRIC = "metric"
+	KIND_EVENT  = "event"
+	KIND_LOG    = "log"
+)
+
+// Record is a single output of a tracker. The name is the metric
+// name, the event type or the log message depending on the kind.
+// A zero timestamp is set by the sink.
+type Record struct {
+	Kind       string            `json:"kind"`
+	Name       string            `json:"name"`
+	Value      float64           `json:"value"`
+	Timestamp  int64             `json:"timestamp"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// ISink receives the records of a tracker run. The sinks which
+// send the records stop as soon as the context is done.
+type ISink interface {
+	Write(
+		ctx context.Context,
+		records []Record,
+	) error
+}
+
+// ICommitter is implemented by the sinks which hold back a part of
+// the written records until the tracker has saved its state, e.g.
+// outputs and counters which must not receive the records which are
+// written again after a failed run.
+type ICommitter interface {
+	Commit() error
+}
+
+// Commit applies the held back records of the given sink, if any.
+func Commit(
+	s ISink,
+) error {
+	if c, ok := s.(ICommitter); ok {
+		return c.Commit()
+	}
+	return nil
+}
+
+// FromMetrics returns a metric record per given metric.
+func FromMetrics(
+	metrics []flush.FlushMetric,
+) []Record {
+	records := make([]Record, 0, len(metrics))
+	for _, metric := range metrics {
+		records = append(records, Record{
+			Kind:       KIND_METRIC,
+			Name:       metric.Name,
+			Value:      metric.Value,
+			Timestamp:  metric.Timestamp,
+			Attributes: metric.Attributes,
+		})
+	}
+	return records
+}
+
+// Multi writes the records to every sink. A failing sink does not
+// keep the records from the others.
+type Multi struct {
+	Sinks []ISink
+}
+
+func NewMulti(
+	sinks ...ISink,
+) *Multi {
+	return &Multi{
+		Sinks: sinks,
+	}
+}
+
+// Write returns the error of the first failing sink wrapped with the
+// messages of all failing sinks.
+func (m *Multi) Write(
+	ctx context.Context,
+	records []Record,
+) error {
+	errs := make([]error, 0)
+	for _, s := range m.Sinks {
+		err := s.Write(ctx, records)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+// Commit commits every sink and returns the errors like Write.
+func (m *Multi) Commit() error {
+	errs := make([]error, 0)
+	for _, s := range m.Sinks {
+		err := Commit(s)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+func joinErrors(
+	errs []error,
+) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	msgs := make([]string, 0, len(errs)-1)
+	for _, err := range errs[1:] {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Errorf("%s: %s: %w", SINK_SINKS_COULD_NOT_WRITE_RECORDS, strings.Join(msgs, "; "), errs[0])
+}
+
+// Redacted redacts the attributes of the records before they are
+// written to the wrapped sink.
+type Redacted struct {
+	Sink     ISink
+	Redactor *redact.Redactor
+}
+
+func NewRedacted(
+	sink ISink,
+	redactor *redact.Redactor,
+) *Redacted {
+	return &Redacted{
+		Sink:     sink,
+		Redactor: redactor,
+	}
+}
+
+func (r *Redacted) Write(
+	ctx context.Context,
+	records []Record,
+) error {
+	redacted := make([]Record, 0, len(records))
+	for _, record := range records {
+		record.Attributes = r.Redactor.Apply(record.Attributes)
+		redacted = append(redacted, record)
+	}
+	return r.Sink.Write(ctx, redacted)
+}
+
+func (r *Redacted) Commit() error {
+	return Commit(r.Sink)
+}
+
+// NewSink creates the sinks of the configured outputs where the
+// given New Relic sink of the tracker is used for the New Relic
+// output. The records are redacted before any sink receives them.
+func NewSink(
+	cfg *config.Config,
+	newRelic ISink,
+) ISink {
+	return NewRedacted(newOutputs(cfg, newRelic), cfg.Redactor())
+}
+
+// newOutputs returns a single output as it is and combines several
+// outputs.
+func newOutputs(
+	cfg *config.Config,
+	newRelic ISink,
+) ISink {
+	sinks := make([]ISink, 0, len(cfg.Outputs))
+	for _, output := range cfg.Outputs {
+		switch output.Type {
+		case config.OUTPUT_NEW_RELIC:
+			sinks = append(sinks, newRelic)
+		case config.OUTPUT_STDOUT:
+			sinks = append(sinks, NewStdout())
+		case config.OUTPUT_FILE:
+			sinks = append(sinks, NewFile(output.Path))
+		case config.OUTPUT_PROMETHEUS:
+			sinks = append(sinks, NewPrometheus(prometheus.DefaultRegistry, cfg.Audit.Events.EventType))
+		}
+	}
+
+	if len(sinks) == 1 {
+		return sinks[0]
+	}
+	return NewMulti(sinks...)
+}
+
+func errKindIsNotSupported(
+	kind string,
+) error {
+	return errors.New(SINK_KIND_IS_NOT_SUPPORTED + ": " + kind)
+}
@@ -0,0 +1,241 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/utr1903/newrelic-tracker-user/pkg/config"
+	"github.com/utr1903/newrelic-tracker-user/pkg/prometheus"
+	"github.com/utr1903/newrelic-tracker-user/pkg/redact"
+)
+
+type metricForwarderMock struct {
+	names []string
+}
+
+func (mf *metricForwarderMock) AddMetric(
+	metricTimestamp int64,
+	metricName string,
+	metricType string,
+	metricValue float64,
+	metricAttributes map[string]string,
+) {
+	mf.names = append(mf.names, metricName)
+}
+
+func (mf *metricForwarderMock) Run(
+	ctx context.Context,
+) error {
+	return nil
+}
+
+type eventForwarderMock struct {
+	eventTypes []string
+}
+
+func (ef *eventForwarderMock) AddEvent(
+	eventType string,
+	timestamp int64,
+	attributes map[string]string,
+) {
+	ef.eventTypes = append(ef.eventTypes, eventType)
+}
+
+func (ef *eventForwarderMock) Run(
+	ctx context.Context,
+) error {
+	return nil
+}
+
+type loggerMock struct {
+	msgs []string
+}
+
+func (l *loggerMock) LogWithFields(
+	lvl logrus.Level,
+	msg string,
+	attributes map[string]string,
+) {
+	l.msgs = append(l.msgs, msg)
+}
+
+func (l *loggerMock) Flush() error {
+	return nil
+}
+
+type sinkMock struct {
+	returnError bool
+	records     []Record
+}
+
+func (s *sinkMock) Write(
+	ctx context.Context,
+	records []Record,
+) error {
+	if s.returnError {
+		return errors.New("error_write")
+	}
+	s.records = append(s.records, records...)
+	return nil
+}
+
+func createRecordsMock() []Record {
+	return []Record{
+		{Kind: KIND_METRIC, Name: "metric", Value: 2, Timestamp: 1000, Attributes: map[string]string{"b": "2", "a": "1"}},
+		{Kind: KIND_EVENT, Name: "Event", Timestamp: 1000, Attributes: map[string]string{"a": "1"}},
+		{Kind: KIND_LOG, Name: "log", Timestamp: 1000, Attributes: map[string]string{"a": "1"}},
+	}
+}
+
+func Test_NewRelicForwardsRecordsByKind(t *testing.T) {
+	mf := &metricForwarderMock{}
+	ef := &eventForwarderMock{}
+	logger := &loggerMock{}
+
+	err := NewNewRelic(mf, ef, logger).Write(context.Background(), createRecordsMock())
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"metric"}, mf.names)
+	assert.Equal(t, []string{"Event"}, ef.eventTypes)
+	assert.Equal(t, []string{"log"}, logger.msgs)
+}
+
+func Test_NewRelicWithoutForwarderFails(t *testing.T) {
+	err := NewNewRelic(&metricForwarderMock{}, nil, nil).Write(context.Background(), createRecordsMock())
+
+	assert.NotNil(t, err)
+	assert.Equal(t, SINK_KIND_IS_NOT_SUPPORTED+": "+KIND_EVENT, err.Error())
+}
+
+func Test_StdoutPrintsRecords(t *testing.T) {
+	var buf bytes.Buffer
+	s := &Stdout{
+		Writer: &buf,
+		now:    time.Now,
+	}
+
+	err := s.Write(context.Background(), createRecordsMock()[:1])
+	assert.Nil(t, err)
+	assert.Equal(t, "", buf.String())
+
+	err = s.Commit()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "1970-01-01T00:00:01Z metric metric 2\n  a: 1\n  b: 2\n", buf.String())
+}
+
+func Test_FileAppendsNewlineDelimitedJson(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.ndjson")
+	s := NewFile(path)
+	s.now = func() time.Time { return time.UnixMilli(5000) }
+
+	err := s.Write(context.Background(), createRecordsMock())
+	assert.Nil(t, err)
+	assert.Nil(t, s.Commit())
+	err = s.Write(context.Background(), []Record{{Kind: KIND_METRIC, Name: "later"}})
+	assert.Nil(t, err)
+	assert.Nil(t, s.Commit())
+
+	f, _ := os.Open(path)
+	defer f.Close()
+	records := []Record{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		record := Record{}
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	assert.Equal(t, 4, len(records))
+	assert.Equal(t, createRecordsMock()[0], records[0])
+	assert.Equal(t, int64(5000), records[3].Timestamp)
+}
+
+func Test_MultiWritesToRemainingSinks(t *testing.T) {
+	failing := &sinkMock{returnError: true}
+	working := &sinkMock{}
+
+	err := NewMulti(failing, working).Write(context.Background(), createRecordsMock())
+
+	assert.NotNil(t, err)
+	assert.Equal(t, "error_write", err.Error())
+	assert.Equal(t, 3, len(working.records))
+}
+
+func Test_MultiHoldsBackLocalOutputsUntilCommit(t *testing.T) {
+	var buf bytes.Buffer
+	s := &Stdout{
+		Writer: &buf,
+		now:    time.Now,
+	}
+	m := NewMulti(&sinkMock{returnError: true}, s)
+
+	err := m.Write(context.Background(), createRecordsMock()[:1])
+
+	assert.NotNil(t, err)
+	assert.Equal(t, "", buf.String())
+	assert.Nil(t, Commit(m))
+	assert.Equal(t, "1970-01-01T00:00:01Z metric metric 2\n  a: 1\n  b: 2\n", buf.String())
+}
+
+func Test_RecordsAreRedacted(t *testing.T) {
+	redactor, _ := redact.NewRedactor("", map[string]string{"a": "drop"})
+	s := &sinkMock{}
+
+	err := NewRedacted(s, redactor).Write(context.Background(), createRecordsMock())
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"b": "2"}, s.records[0].Attributes)
+}
+
+func Test_OutputsAreCombined(t *testing.T) {
+	newRelic := &sinkMock{}
+
+	single := newOutputs(&config.Config{
+		Outputs: []config.Output{{Type: config.OUTPUT_NEW_RELIC}},
+	}, newRelic)
+	combined := newOutputs(&config.Config{
+		Outputs: []config.Output{
+			{Type: config.OUTPUT_NEW_RELIC},
+			{Type: config.OUTPUT_STDOUT},
+			{Type: config.OUTPUT_FILE, Path: "records.ndjson"},
+			{Type: config.OUTPUT_PROMETHEUS},
+		},
+	}, newRelic)
+
+	assert.Equal(t, newRelic, single)
+	assert.Equal(t, 4, len(combined.(*Multi).Sinks))
+}
+
+func Test_PrometheusExposesAggregates(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	s := NewPrometheus(registry, "UserAuditEvent")
+
+	err := s.Write(context.Background(), []Record{
+		{Kind: KIND_METRIC, Name: "tracker.users.type", Value: 1, Attributes: map[string]string{"tracker.users.email": "a@b.com"}},
+		{Kind: KIND_METRIC, Name: "tracker.users.type.count", Value: 4, Attributes: map[string]string{"tracker.users.type": "1", "tracker.users.typeName": "fullPlatform"}},
+		{Kind: KIND_METRIC, Name: "tracker.users.audit.value", Value: 1, Attributes: map[string]string{"tracker.users.audit.actionIdentifier": "user.create", "tracker.users.audit.actorType": "user"}},
+		{Kind: KIND_EVENT, Name: "UserAuditEvent", Attributes: map[string]string{"tracker.users.audit.actionIdentifier": "user.create", "tracker.users.audit.actorType": "user"}},
+	})
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	registry.Write(&buf)
+	assert.NotContains(t, buf.String(), "audit_events_total")
+
+	assert.Nil(t, NewRedacted(NewMulti(s), nil).Commit())
+	buf.Reset()
+	registry.Write(&buf)
+
+	assert.NotContains(t, buf.String(), "a@b.com")
+	assert.Contains(t, buf.String(), `newrelic_tracker_users_type_count{type="1",type_name="fullPlatform"} 4`)
+	assert.Contains(t, buf.String(), `newrelic_tracker_users_audit_events_total{action_identifier="user.create",actor_type="user"} 2`)
+}
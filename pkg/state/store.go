@@ -0,0 +1,110 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const (
+	STATE_COULD_NOT_BE_READ    = "state could not be read"
+	STATE_COULD_NOT_BE_PARSED  = "state could not be parsed"
+	STATE_COULD_NOT_BE_CREATED = "state could not be created"
+	STATE_COULD_NOT_BE_WRITTEN = "state could not be written"
+)
+
+// IStore persists the state of the trackers between runs.
+type IStore interface {
+	Load(
+		name string,
+		value any,
+	) (
+		bool,
+		error,
+	)
+	Save(
+		name string,
+		value any,
+	) error
+}
+
+// Store keeps every state as a JSON file in a local directory.
+type Store struct {
+	Dir string
+}
+
+func NewStore(
+	dir string,
+) *Store {
+	return &Store{
+		Dir: dir,
+	}
+}
+
+// Load reads the state with the given name into the value and
+// returns false if the state does not exist yet.
+func (s *Store) Load(
+	name string,
+	value any,
+) (
+	bool,
+	error,
+) {
+	bytes, err := os.ReadFile(s.getPath(name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, errors.New(STATE_COULD_NOT_BE_READ + ": " + err.Error())
+	}
+
+	err = json.Unmarshal(bytes, value)
+	if err != nil {
+		return false, errors.New(STATE_COULD_NOT_BE_PARSED + ": " + err.Error())
+	}
+	return true, nil
+}
+
+// Save writes the value as the state with the given name. The file
+// is replaced atomically so that a crash does not corrupt it.
+func (s *Store) Save(
+	name string,
+	value any,
+) error {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return errors.New(STATE_COULD_NOT_BE_CREATED + ": " + err.Error())
+	}
+
+	err = os.MkdirAll(s.Dir, 0700)
+	if err != nil {
+		return errors.New(STATE_COULD_NOT_BE_WRITTEN + ": " + err.Error())
+	}
+
+	tmp, err := os.CreateTemp(s.Dir, name+".*.tmp")
+	if err != nil {
+		return errors.New(STATE_COULD_NOT_BE_WRITTEN + ": " + err.Error())
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(bytes)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.New(STATE_COULD_NOT_BE_WRITTEN + ": " + err.Error())
+	}
+
+	err = os.Rename(tmp.Name(), s.getPath(name))
+	if err != nil {
+		return errors.New(STATE_COULD_NOT_BE_WRITTEN + ": " + err.Error())
+	}
+	return nil
+}
+
+func (s *Store) getPath(
+	name string,
+) string {
+	return filepath.Join(s.Dir, name+".json")
+}
@@ -0,0 +1,61 @@
+package tracker
+
+import "errors"
+
+// Phase is the step of a tracker run in which an error has occurred.
+type Phase string
+
+const (
+	PHASE_RUN           Phase = "run"
+	PHASE_FETCH         Phase = "fetch"
+	PHASE_FLUSH_METRICS Phase = "flushMetrics"
+	PHASE_FLUSH_LOGS    Phase = "flushLogs"
+	PHASE_FLUSH_EVENTS  Phase = "flushEvents"
+	PHASE_STATE         Phase = "state"
+	PHASE_EXPORT        Phase = "export"
+)
+
+// Error wraps the error of a tracker run with the phase it has
+// occurred in so that callers can branch on the failure kind.
+type Error struct {
+	Phase Phase
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap returns the given error wrapped with the given phase.
+// A nil error stays nil.
+func Wrap(
+	phase Phase,
+	err error,
+) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{
+		Phase: phase,
+		Err:   err,
+	}
+}
+
+// GetPhase returns the phase of the given error and whether
+// the error was wrapped with one.
+func GetPhase(
+	err error,
+) (
+	Phase,
+	bool,
+) {
+	var trackerErr *Error
+	if errors.As(err, &trackerErr) {
+		return trackerErr.Phase, true
+	}
+	return "", false
+}
@@ -0,0 +1,88 @@
+package tracker
+
+import (
+	"io"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	logging "github.com/utr1903/newrelic-tracker-internal/logging"
+)
+
+// syncLogger serializes the calls to a logger which is not safe
+// for concurrent use.
+type syncLogger struct {
+	mu     sync.Mutex
+	logger logging.ILogger
+}
+
+// NewSyncLogger wraps the given logger so that it can be shared
+// between goroutines.
+func NewSyncLogger(
+	logger logging.ILogger,
+) logging.ILogger {
+	return &syncLogger{
+		logger: logger,
+	}
+}
+
+func (l *syncLogger) LogWithFields(
+	lvl logrus.Level,
+	msg string,
+	attributes map[string]string,
+) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logger.LogWithFields(lvl, msg, attributes)
+}
+
+func (l *syncLogger) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.logger.Flush()
+}
+
+// localLogger writes the logs as JSON to the given writer without
+// forwarding them to New Relic.
+type localLogger struct {
+	log *logrus.Logger
+}
+
+// NewLocalLogger creates a logger for the commands whose standard
+// output is reserved for their result, e.g. the export.
+func NewLocalLogger(
+	logLevel string,
+	w io.Writer,
+) logging.ILogger {
+	l := logrus.New()
+	l.Out = w
+	l.Formatter = &logrus.JSONFormatter{}
+	l.Level = logrus.ErrorLevel
+	if logLevel == "DEBUG" {
+		l.Level = logrus.DebugLevel
+	}
+	return &localLogger{
+		log: l,
+	}
+}
+
+func (l *localLogger) LogWithFields(
+	lvl logrus.Level,
+	msg string,
+	attributes map[string]string,
+) {
+	fields := logrus.Fields{}
+	for key, val := range attributes {
+		fields[key] = val
+	}
+
+	switch lvl {
+	case logrus.ErrorLevel:
+		l.log.WithFields(fields).Error(msg)
+	default:
+		l.log.WithFields(fields).Debug(msg)
+	}
+}
+
+func (l *localLogger) Flush() error {
+	return nil
+}
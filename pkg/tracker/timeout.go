@@ -0,0 +1,117 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// TimeoutError is returned when the deadline of a phase or the
+// budget of the whole run has expired.
+type TimeoutError struct {
+	Phase   Phase
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return "phase " + string(e.Phase) + " has timed out after " + e.Timeout.String()
+}
+
+func (e *TimeoutError) Is(
+	target error,
+) bool {
+	return target == context.DeadlineExceeded
+}
+
+// WithTimeout returns a context which expires after the given
+// timeout. A non-positive timeout sets no deadline.
+func WithTimeout(
+	ctx context.Context,
+	timeout time.Duration,
+) (
+	context.Context,
+	context.CancelFunc,
+) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// RunPhase runs the given function within the deadline of the phase.
+// The returned error is wrapped with the phase. If the context has
+// expired, the error is a TimeoutError which tells whether the phase
+// deadline or the run budget of the parent context has expired.
+func RunPhase(
+	ctx context.Context,
+	phase Phase,
+	timeout time.Duration,
+	runTimeout time.Duration,
+	fn func(ctx context.Context) error,
+) error {
+	phaseCtx, cancel := WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := fn(phaseCtx)
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		if ctx.Err() != nil {
+			err = &TimeoutError{
+				Phase:   PHASE_RUN,
+				Timeout: runTimeout,
+			}
+		} else {
+			err = &TimeoutError{
+				Phase:   phase,
+				Timeout: timeout,
+			}
+		}
+	}
+	return Wrap(phase, err)
+}
+
+// Sleep blocks for the given duration unless the context is done
+// before.
+func Sleep(
+	ctx context.Context,
+	d time.Duration,
+) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Await runs the given blocking function and returns as soon as
+// either the function has finished or the context is done. The
+// function keeps running in the background, so this is only a last
+// resort for the calls which take no context, e.g. the log flush of
+// the internal forwarder.
+func Await(
+	ctx context.Context,
+	fn func() error,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,527 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	flush "github.com/utr1903/newrelic-tracker-internal/flush"
+	"github.com/utr1903/newrelic-tracker-user/pkg/graphql/authorization"
+	"github.com/utr1903/newrelic-tracker-user/pkg/graphql/client"
+	"github.com/utr1903/newrelic-tracker-user/pkg/graphql/gqlerror"
+	"github.com/utr1903/newrelic-tracker-user/pkg/graphql/user"
+	"github.com/utr1903/newrelic-tracker-user/pkg/sink"
+	"github.com/utr1903/newrelic-tracker-user/pkg/workerpool"
+)
+
+const USERS_GROUP_IS_NOT_RETURNED = "group is not returned"
+
+const ACCESS_ROLE_GRANTED = "role.granted"
+
+const queryTemplateGroups = `
+{
+	actor {
+		organization {
+			userManagement {
+				authenticationDomains(id: "{{ .AuthDomainId }}") {
+					authenticationDomains {
+						id
+						groups(cursor: {{ .Cursor }}) {
+							nextCursor
+							groups {
+								id
+								displayName
+								users {
+									nextCursor
+									users {
+										id
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+`
+
+const queryTemplateGroupMembers = `
+{
+	actor {
+		organization {
+			userManagement {
+				authenticationDomains(id: "{{ .AuthDomainId }}") {
+					authenticationDomains {
+						id
+						groups(id: "{{ .GroupId }}") {
+							groups {
+								id
+								users(cursor: {{ .Cursor }}) {
+									nextCursor
+									users {
+										id
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+`
+
+const queryTemplateRoles = `
+{
+	actor {
+		organization {
+			authorizationManagement {
+				authenticationDomains(id: "{{ .AuthDomainId }}") {
+					authenticationDomains {
+						id
+						groups(cursor: {{ .Cursor }}) {
+							nextCursor
+							groups {
+								id
+								displayName
+								roles {
+									nextCursor
+									roles {
+										id
+										roleId
+										name
+										accountId
+										type
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+`
+
+const queryTemplateGroupRoles = `
+{
+	actor {
+		organization {
+			authorizationManagement {
+				authenticationDomains(id: "{{ .AuthDomainId }}") {
+					authenticationDomains {
+						id
+						groups(id: "{{ .GroupId }}") {
+							groups {
+								id
+								roles(cursor: {{ .Cursor }}) {
+									nextCursor
+									roles {
+										id
+										roleId
+										name
+										accountId
+										type
+									}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+`
+
+type queryVariablesGroup struct {
+	AuthDomainId string
+	GroupId      string
+	Cursor       string
+}
+
+// group is a group of an authentication domain with its members
+// and the roles it grants on accounts.
+type group struct {
+	AuthDomainId string
+	Id           string
+	Name         string
+	MemberIds    []string
+	Roles        []groupRole
+}
+
+type groupRole struct {
+	RoleId    string
+	Name      string
+	AccountId int64
+	Type      string
+}
+
+// fetchAccess fetches the groups of all domains concurrently. The
+// groups are returned in the order of the given domains.
+func (u *Users) fetchAccess(
+	ctx context.Context,
+	authDomainIds []string,
+) (
+	[]group,
+	error,
+) {
+	groupsPerDomain := make([][]group, len(authDomainIds))
+	err := workerpool.ForEachFailFast(ctx, u.Workers, len(authDomainIds),
+		func(ctx context.Context, i int) error {
+			var err error
+			groupsPerDomain[i], err = u.fetchDomainGroups(ctx, authDomainIds[i])
+			return err
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]group, 0)
+	for _, domainGroups := range groupsPerDomain {
+		groups = append(groups, domainGroups...)
+	}
+	return groups, nil
+}
+
+// fetchDomainGroups fetches the groups of a domain with their
+// members per user management and their roles per authorization
+// management.
+func (u *Users) fetchDomainGroups(
+	ctx context.Context,
+	authDomainId string,
+) (
+	[]group,
+	error,
+) {
+	groups := make([]group, 0)
+	groupIndexes := map[string]int{}
+
+	// Loop until fetching all groups with their members
+	err := newCursorIterator(u.MaxPages).forEachPage(
+		func(cursor string) (*string, error) {
+			authDomain, err := fetchUserManagementPage(ctx, u, u.GqlcGroups, &queryVariablesGroup{
+				AuthDomainId: authDomainId,
+				Cursor:       cursor,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			for _, g := range authDomain.Groups.Groups {
+				memberIds := getUserIds(g.Users.Users)
+				if g.Users.NextCursor != nil {
+					more, err := u.fetchGroupMembers(ctx, authDomainId, g.Id, g.Users.NextCursor)
+					if err != nil {
+						return nil, err
+					}
+					memberIds = append(memberIds, more...)
+				}
+
+				groupIndexes[g.Id] = len(groups)
+				groups = append(groups, group{
+					AuthDomainId: authDomainId,
+					Id:           g.Id,
+					Name:         g.DisplayName,
+					MemberIds:    memberIds,
+					Roles:        make([]groupRole, 0),
+				})
+			}
+			return authDomain.Groups.NextCursor, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	// Loop until fetching the roles of all groups
+	err = newCursorIterator(u.MaxPages).forEachPage(
+		func(cursor string) (*string, error) {
+			authDomain, err := fetchAuthorizationManagementPage(ctx, u, u.GqlcRoles, &queryVariablesGroup{
+				AuthDomainId: authDomainId,
+				Cursor:       cursor,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			for _, g := range authDomain.Groups.Groups {
+				roles := getGroupRoles(g.Roles.Roles)
+				if g.Roles.NextCursor != nil {
+					more, err := u.fetchGroupRoles(ctx, authDomainId, g.Id, g.Roles.NextCursor)
+					if err != nil {
+						return nil, err
+					}
+					roles = append(roles, more...)
+				}
+
+				// Keep the groups which user management has not returned
+				i, ok := groupIndexes[g.Id]
+				if !ok {
+					groupIndexes[g.Id] = len(groups)
+					groups = append(groups, group{
+						AuthDomainId: authDomainId,
+						Id:           g.Id,
+						Name:         g.DisplayName,
+						MemberIds:    make([]string, 0),
+					})
+					i = len(groups) - 1
+				}
+				groups[i].Roles = append(groups[i].Roles, roles...)
+			}
+			return authDomain.Groups.NextCursor, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// fetchGroupMembers fetches the remaining members of a group which
+// has more members than fit into the page of the groups.
+func (u *Users) fetchGroupMembers(
+	ctx context.Context,
+	authDomainId string,
+	groupId string,
+	cursor *string,
+) (
+	[]string,
+	error,
+) {
+	memberIds := make([]string, 0)
+	err := newCursorIterator(u.MaxPages).startAt(cursor).forEachPage(
+		func(cursor string) (*string, error) {
+			authDomain, err := fetchUserManagementPage(ctx, u, u.GqlcGroupMembers, &queryVariablesGroup{
+				AuthDomainId: authDomainId,
+				GroupId:      groupId,
+				Cursor:       cursor,
+			})
+			if err != nil {
+				return nil, err
+			}
+			if len(authDomain.Groups.Groups) == 0 {
+				return nil, errors.New(USERS_GROUP_IS_NOT_RETURNED + ": " + groupId)
+			}
+
+			users := authDomain.Groups.Groups[0].Users
+			memberIds = append(memberIds, getUserIds(users.Users)...)
+			return users.NextCursor, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return memberIds, nil
+}
+
+// fetchGroupRoles fetches the remaining roles of a group which has
+// more roles than fit into the page of the groups.
+func (u *Users) fetchGroupRoles(
+	ctx context.Context,
+	authDomainId string,
+	groupId string,
+	cursor *string,
+) (
+	[]groupRole,
+	error,
+) {
+	roles := make([]groupRole, 0)
+	err := newCursorIterator(u.MaxPages).startAt(cursor).forEachPage(
+		func(cursor string) (*string, error) {
+			authDomain, err := fetchAuthorizationManagementPage(ctx, u, u.GqlcGroupRoles, &queryVariablesGroup{
+				AuthDomainId: authDomainId,
+				GroupId:      groupId,
+				Cursor:       cursor,
+			})
+			if err != nil {
+				return nil, err
+			}
+			if len(authDomain.Groups.Groups) == 0 {
+				return nil, errors.New(USERS_GROUP_IS_NOT_RETURNED + ": " + groupId)
+			}
+
+			groupRoles := authDomain.Groups.Groups[0].Roles
+			roles = append(roles, getGroupRoles(groupRoles.Roles)...)
+			return groupRoles.NextCursor, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func fetchUserManagementPage(
+	ctx context.Context,
+	u *Users,
+	gqlc client.IGraphQlClient,
+	qv *queryVariablesGroup,
+) (
+	*user.AuthenticationDomain,
+	error,
+) {
+	res := &user.GraphQlUserResponse{}
+	return fetchGroupsPage(ctx, u, gqlc, qv, res, func() []user.AuthenticationDomain {
+		return res.GetAuthDomains().AuthenticationDomains
+	})
+}
+
+func fetchAuthorizationManagementPage(
+	ctx context.Context,
+	u *Users,
+	gqlc client.IGraphQlClient,
+	qv *queryVariablesGroup,
+) (
+	*authorization.AuthenticationDomain,
+	error,
+) {
+	res := &authorization.GraphQlAuthorizationResponse{}
+	return fetchGroupsPage(ctx, u, gqlc, qv, res, func() []authorization.AuthenticationDomain {
+		return res.GetAuthDomains().AuthenticationDomains
+	})
+}
+
+// fetchGroupsPage fetches a page of either the user or the
+// authorization management and returns its only domain.
+func fetchGroupsPage[T any](
+	ctx context.Context,
+	u *Users,
+	gqlc client.IGraphQlClient,
+	qv *queryVariablesGroup,
+	res gqlerror.IResponse,
+	getAuthDomains func() []T,
+) (
+	*T,
+	error,
+) {
+	err := gqlc.Execute(ctx, qv, res)
+	if err != nil {
+		return nil, err
+	}
+
+	authDomains := getAuthDomains()
+	err = u.checkErrors(
+		map[string]string{
+			"tracker.package":      "pkg.users",
+			"tracker.file":         "access.go",
+			"tracker.authDomainId": qv.AuthDomainId,
+			"tracker.groupId":      qv.GroupId,
+		},
+		res.GetErrors(),
+		len(authDomains) != 0,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(authDomains) == 0 {
+		return nil, errors.New(USERS_AUTH_DOMAIN_IS_NOT_RETURNED + ": " + qv.AuthDomainId)
+	}
+	return &authDomains[0], nil
+}
+
+func getUserIds(
+	users []user.User,
+) []string {
+	userIds := make([]string, 0, len(users))
+	for _, user := range users {
+		userIds = append(userIds, user.Id)
+	}
+	return userIds
+}
+
+func getGroupRoles(
+	roles []authorization.Role,
+) []groupRole {
+	groupRoles := make([]groupRole, 0, len(roles))
+	for _, role := range roles {
+		groupRoles = append(groupRoles, groupRole{
+			RoleId:    role.RoleId,
+			Name:      role.Name,
+			AccountId: role.AccountId,
+			Type:      role.Type,
+		})
+	}
+	return groupRoles
+}
+
+// createAccessMetrics creates a metric per group membership of a
+// user. The email is only set for the members which are known.
+func createAccessMetrics(
+	authDomainUsers []authDomainUser,
+	groups []group,
+) []flush.FlushMetric {
+	emails := getEmailsById(authDomainUsers)
+
+	metrics := make([]flush.FlushMetric, 0)
+	for _, g := range groups {
+		for _, memberId := range g.MemberIds {
+			attributes := map[string]string{
+				"tracker.users.authDomainId": g.AuthDomainId,
+				"tracker.users.id":           memberId,
+				"tracker.users.groupId":      g.Id,
+				"tracker.users.groupName":    g.Name,
+			}
+			if email, ok := emails[memberId]; ok {
+				attributes["tracker.users.email"] = email
+			}
+
+			metrics = append(metrics, flush.FlushMetric{
+				Name:       "tracker.users.group.membership",
+				Value:      1,
+				Attributes: attributes,
+			})
+		}
+	}
+	return metrics
+}
+
+// createRoleGrantRecords creates a log record per role which a user
+// is granted on an account through a group. The grants are not
+// written as metrics since there is one per user, group and role.
+func createRoleGrantRecords(
+	authDomainUsers []authDomainUser,
+	groups []group,
+) []sink.Record {
+	emails := getEmailsById(authDomainUsers)
+
+	records := make([]sink.Record, 0)
+	for _, g := range groups {
+		for _, memberId := range g.MemberIds {
+			for _, role := range g.Roles {
+				attributes := map[string]string{
+					"tracker.users.event":        ACCESS_ROLE_GRANTED,
+					"tracker.users.authDomainId": g.AuthDomainId,
+					"tracker.users.id":           memberId,
+					"tracker.users.groupId":      g.Id,
+					"tracker.users.groupName":    g.Name,
+					"tracker.users.roleId":       role.RoleId,
+					"tracker.users.roleName":     role.Name,
+					"tracker.users.roleType":     role.Type,
+					"tracker.users.accountId":    strconv.FormatInt(role.AccountId, 10),
+				}
+				if email, ok := emails[memberId]; ok {
+					attributes["tracker.users.email"] = email
+				}
+
+				records = append(records, sink.Record{
+					Kind:       sink.KIND_LOG,
+					Name:       ACCESS_ROLE_GRANTED,
+					Attributes: attributes,
+				})
+			}
+		}
+	}
+	return records
+}
+
+func getEmailsById(
+	authDomainUsers []authDomainUser,
+) map[string]string {
+	emails := make(map[string]string, len(authDomainUsers))
+	for _, user := range authDomainUsers {
+		emails[user.Id] = user.Email
+	}
+	return emails
+}
@@ -0,0 +1,90 @@
+package users
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/utr1903/newrelic-tracker-user/pkg/config"
+)
+
+const (
+	ACTIVITY_ACTIVE          = "active"
+	ACTIVITY_IDLE            = "idle"
+	ACTIVITY_DORMANT         = "dormant"
+	ACTIVITY_NEVER_LOGGED_IN = "neverLoggedIn"
+)
+
+// activityClassifier puts users into buckets by the days since
+// their last activity relative to a fixed point in time.
+type activityClassifier struct {
+	idleDays    int
+	dormantDays int
+	now         time.Time
+}
+
+// newActivityClassifier creates a classifier with the thresholds of
+// the config which are validated to be ascending.
+func newActivityClassifier(
+	inactivity config.Inactivity,
+	now time.Time,
+) *activityClassifier {
+	return &activityClassifier{
+		idleDays:    inactivity.IdleDays,
+		dormantDays: inactivity.DormantDays,
+		now:         now,
+	}
+}
+
+// classify returns the bucket of the user and the full days since
+// the last activity. The days are only valid if the user has been
+// active at least once.
+func (c *activityClassifier) classify(
+	lastActive string,
+) (
+	string,
+	int,
+	bool,
+) {
+	t, ok := parseLastActive(lastActive)
+	if !ok {
+		return ACTIVITY_NEVER_LOGGED_IN, 0, false
+	}
+
+	days := int(c.now.Sub(t).Hours() / 24)
+	if days < 0 {
+		days = 0
+	}
+
+	switch {
+	case days >= c.dormantDays:
+		return ACTIVITY_DORMANT, days, true
+	case days >= c.idleDays:
+		return ACTIVITY_IDLE, days, true
+	default:
+		return ACTIVITY_ACTIVE, days, true
+	}
+}
+
+// parseLastActive parses the last activity which NerdGraph returns
+// either as RFC 3339 timestamp or as epoch milliseconds.
+func parseLastActive(
+	lastActive string,
+) (
+	time.Time,
+	bool,
+) {
+	if lastActive == "" {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(time.RFC3339, lastActive)
+	if err == nil {
+		return t, true
+	}
+
+	millis, err := strconv.ParseInt(lastActive, 10, 64)
+	if err == nil && millis > 0 {
+		return time.UnixMilli(millis), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,112 @@
+package users
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	flush "github.com/utr1903/newrelic-tracker-internal/flush"
+)
+
+// counter counts the users per distinct set of attributes.
+type counter struct {
+	counts     map[string]int
+	attributes map[string]map[string]string
+}
+
+func newCounter() *counter {
+	return &counter{
+		counts:     map[string]int{},
+		attributes: map[string]map[string]string{},
+	}
+}
+
+func (c *counter) add(
+	attributes map[string]string,
+) {
+	key := getCounterKey(attributes)
+	c.counts[key]++
+	c.attributes[key] = attributes
+}
+
+// getCounterKey returns the attributes in alphabetical order where
+// every name and value is prefixed with its length so that values
+// containing separators cannot collide with other attributes.
+func getCounterKey(
+	attributes map[string]string,
+) string {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	for _, name := range names {
+		for _, part := range []string{name, attributes[name]} {
+			key.WriteString(strconv.Itoa(len(part)))
+			key.WriteByte(':')
+			key.WriteString(part)
+		}
+	}
+	return key.String()
+}
+
+// createMetrics returns a metric per set of attributes in a stable
+// order.
+func (c *counter) createMetrics(
+	name string,
+) []flush.FlushMetric {
+	keys := make([]string, 0, len(c.counts))
+	for key := range c.counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	metrics := make([]flush.FlushMetric, 0, len(keys))
+	for _, key := range keys {
+		metrics = append(metrics, flush.FlushMetric{
+			Name:       name,
+			Value:      float64(c.counts[key]),
+			Attributes: c.attributes[key],
+		})
+	}
+	return metrics
+}
+
+// createSeatMetrics counts the users per user type, per
+// authentication domain and user type, per email verification state
+// and per time zone.
+func createSeatMetrics(
+	authDomainUsers []authDomainUser,
+) []flush.FlushMetric {
+	perType := newCounter()
+	perAuthDomain := newCounter()
+	perEmailVerificationState := newCounter()
+	perTimeZone := newCounter()
+
+	for _, user := range authDomainUsers {
+		perType.add(map[string]string{
+			"tracker.users.type":     user.UserType,
+			"tracker.users.typeName": user.UserTypeName,
+		})
+		perAuthDomain.add(map[string]string{
+			"tracker.users.authDomainId": user.AuthDomainId,
+			"tracker.users.type":         user.UserType,
+			"tracker.users.typeName":     user.UserTypeName,
+		})
+		perEmailVerificationState.add(map[string]string{
+			"tracker.users.emailVerificationState": user.EmailVerificationState,
+		})
+		perTimeZone.add(map[string]string{
+			"tracker.users.timeZone": user.TimeZone,
+		})
+	}
+
+	metrics := make([]flush.FlushMetric, 0)
+	metrics = append(metrics, perType.createMetrics("tracker.users.type.count")...)
+	metrics = append(metrics, perAuthDomain.createMetrics("tracker.users.authDomain.count")...)
+	metrics = append(metrics, perEmailVerificationState.createMetrics("tracker.users.emailVerificationState.count")...)
+	metrics = append(metrics, perTimeZone.createMetrics("tracker.users.timeZone.count")...)
+	return metrics
+}
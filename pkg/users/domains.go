@@ -0,0 +1,191 @@
+package users
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	flush "github.com/utr1903/newrelic-tracker-internal/flush"
+	"github.com/utr1903/newrelic-tracker-user/pkg/graphql/gqlerror"
+	"github.com/utr1903/newrelic-tracker-user/pkg/graphql/user"
+)
+
+const USERS_DOMAIN_SETTINGS_COULD_NOT_BE_FETCHED = "domain settings could not be fetched"
+
+const queryTemplateDomainSettings = `
+{
+	actor {
+		organization {
+			userManagement {
+				authenticationDomains(cursor: {{ .Cursor }}) {
+					nextCursor
+					authenticationDomains {
+						id
+						provisioningType
+						authenticationType
+						userUpgradeSettings {
+							mode
+							defaultUserType
+						}
+						sessionSettings {
+							idleTimeoutMinutes
+							sessionTimeoutMinutes
+						}
+					}
+				}
+			}
+		}
+	}
+}
+`
+
+// authDomain is an authentication domain together with its
+// configuration which defines how its users are provisioned and how
+// they log in.
+type authDomain struct {
+	Id   string
+	Name string
+
+	// Settings is nil if the settings could not be fetched
+	Settings *authDomainSettings
+}
+
+type authDomainSettings struct {
+	ProvisioningType       string
+	AuthenticationType     string
+	UpgradeMode            string
+	UpgradeDefaultUserType string
+	IdleTimeoutMinutes     *int
+	SessionTimeoutMinutes  *int
+}
+
+func newAuthDomain(
+	domain user.AuthenticationDomain,
+) authDomain {
+	return authDomain{
+		Id:   domain.Id,
+		Name: domain.Name,
+	}
+}
+
+func newAuthDomainSettings(
+	domain user.AuthenticationDomain,
+) *authDomainSettings {
+	return &authDomainSettings{
+		ProvisioningType:       domain.ProvisioningType,
+		AuthenticationType:     domain.AuthenticationType,
+		UpgradeMode:            domain.UserUpgradeSettings.Mode,
+		UpgradeDefaultUserType: domain.UserUpgradeSettings.DefaultUserType,
+		IdleTimeoutMinutes:     domain.SessionSettings.IdleTimeoutMinutes,
+		SessionTimeoutMinutes:  domain.SessionSettings.SessionTimeoutMinutes,
+	}
+}
+
+func getAuthDomainIds(
+	authDomains []authDomain,
+) []string {
+	authDomainIds := make([]string, 0, len(authDomains))
+	for _, domain := range authDomains {
+		authDomainIds = append(authDomainIds, domain.Id)
+	}
+	return authDomainIds
+}
+
+// fetchDomainSettings sets the settings of the given domains. The
+// settings are queried apart from the domains so that a failure only
+// leaves them out of the metrics instead of failing the run.
+func (u *Users) fetchDomainSettings(
+	ctx context.Context,
+	authDomains []authDomain,
+) {
+	byId := make(map[string]int, len(authDomains))
+	for i, domain := range authDomains {
+		byId[domain.Id] = i
+	}
+
+	err := newCursorIterator(u.MaxPages).forEachPage(
+		func(cursor string) (*string, error) {
+			qv := &queryVariablesDomains{
+				Cursor: cursor,
+			}
+
+			res := &user.GraphQlUserResponse{}
+			err := u.GqlcDomainSettings.Execute(ctx, qv, res)
+			if err != nil {
+				return nil, err
+			}
+
+			authDomainsRes := res.GetAuthDomains()
+			err = gqlerror.Check(u.Logger, USERS_DOMAIN_SETTINGS_COULD_NOT_BE_FETCHED,
+				map[string]string{
+					"tracker.package": "pkg.users",
+					"tracker.file":    "domains.go",
+				},
+				res.Errors,
+				authDomainsRes.AuthenticationDomains != nil,
+			)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, domain := range authDomainsRes.AuthenticationDomains {
+				if i, ok := byId[domain.Id]; ok {
+					authDomains[i].Settings = newAuthDomainSettings(domain)
+				}
+			}
+			return authDomainsRes.NextCursor, nil
+		})
+	if err != nil {
+		u.Logger.LogWithFields(logrus.ErrorLevel, USERS_DOMAIN_SETTINGS_COULD_NOT_BE_FETCHED,
+			map[string]string{
+				"tracker.package": "pkg.users",
+				"tracker.file":    "domains.go",
+				"tracker.error":   err.Error(),
+			})
+	}
+}
+
+// createDomainMetrics creates an info metric per domain which
+// carries its settings as attributes and the session timeouts as
+// separate metrics. Timeouts which are not set are left out.
+func createDomainMetrics(
+	authDomains []authDomain,
+) []flush.FlushMetric {
+	metrics := make([]flush.FlushMetric, 0, 3*len(authDomains))
+	for _, domain := range authDomains {
+		attributes := map[string]string{
+			"tracker.users.authDomainId":   domain.Id,
+			"tracker.users.authDomainName": domain.Name,
+		}
+		settings := domain.Settings
+		if settings != nil {
+			attributes["tracker.users.authDomain.provisioningType"] = settings.ProvisioningType
+			attributes["tracker.users.authDomain.authenticationType"] = settings.AuthenticationType
+			attributes["tracker.users.authDomain.upgradeMode"] = settings.UpgradeMode
+			attributes["tracker.users.authDomain.upgradeDefaultType"] = settings.UpgradeDefaultUserType
+		}
+		metrics = append(metrics, flush.FlushMetric{
+			Name:       "tracker.users.authDomain.info",
+			Value:      1,
+			Attributes: attributes,
+		})
+		if settings == nil {
+			continue
+		}
+
+		if settings.IdleTimeoutMinutes != nil {
+			metrics = append(metrics, flush.FlushMetric{
+				Name:       "tracker.users.authDomain.idleTimeoutMinutes",
+				Value:      float64(*settings.IdleTimeoutMinutes),
+				Attributes: attributes,
+			})
+		}
+		if settings.SessionTimeoutMinutes != nil {
+			metrics = append(metrics, flush.FlushMetric{
+				Name:       "tracker.users.authDomain.sessionTimeoutMinutes",
+				Value:      float64(*settings.SessionTimeoutMinutes),
+				Attributes: attributes,
+			})
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,211 @@
+package users
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/utr1903/newrelic-tracker-user/pkg/config"
+	"github.com/utr1903/newrelic-tracker-user/pkg/redact"
+	"github.com/utr1903/newrelic-tracker-user/pkg/tracker"
+)
+
+const (
+	USERS_EXPORT_COULD_NOT_BE_WRITTEN = "export could not be written"
+)
+
+// exportColumnAttributes maps the columns of the export to the
+// attributes which carry the same values in the other outputs so
+// that the configured redaction applies to the export as well.
+var exportColumnAttributes = map[string]string{
+	config.EXPORT_COLUMN_DOMAIN_NAME:        "tracker.users.authDomainName",
+	config.EXPORT_COLUMN_USER_ID:            "tracker.users.id",
+	config.EXPORT_COLUMN_NAME:               "tracker.users.name",
+	config.EXPORT_COLUMN_EMAIL:              "tracker.users.email",
+	config.EXPORT_COLUMN_TYPE:               "tracker.users.typeName",
+	config.EXPORT_COLUMN_VERIFICATION_STATE: "tracker.users.emailVerificationState",
+	config.EXPORT_COLUMN_LAST_ACTIVE:        "tracker.users.lastActive",
+	config.EXPORT_COLUMN_TIME_ZONE:          "tracker.users.timeZone",
+}
+
+// utf8Bom lets spreadsheet applications detect the encoding of the
+// export.
+const utf8Bom = "\ufeff"
+
+// Export fetches the users of all domains and writes them as CSV
+// with the configured columns.
+func (u *Users) Export(
+	ctx context.Context,
+	w io.Writer,
+	export config.Export,
+) error {
+	runTimeout := u.Timeouts.Run.Duration()
+	ctx, cancel := tracker.WithTimeout(ctx, runTimeout)
+	defer cancel()
+
+	// Fetch the domains & users per GraphQL
+	var authDomains []authDomain
+	var authDomainUsers []authDomainUser
+	err := tracker.RunPhase(ctx, tracker.PHASE_FETCH, u.Timeouts.Fetch.Duration(), runTimeout,
+		func(ctx context.Context) error {
+			var err error
+			authDomains, err = u.fetchDomains(ctx)
+			if err != nil {
+				return err
+			}
+			authDomainUsers, err = u.fetchUsers(ctx, getAuthDomainIds(authDomains))
+			return err
+		})
+	if err != nil {
+		return err
+	}
+
+	rows := createExportRows(authDomains, authDomainUsers, u.Redactor, export.Mask)
+	sortExportRows(rows, export.SortBy)
+
+	err = writeExport(w, export.Columns, rows)
+	if err != nil {
+		return tracker.Wrap(tracker.PHASE_EXPORT, err)
+	}
+	return nil
+}
+
+// createExportRows returns a row per user with every column. The
+// configured redaction is applied to the columns and the names and
+// emails are masked on top if requested. Dropped values are left
+// empty.
+func createExportRows(
+	authDomains []authDomain,
+	authDomainUsers []authDomainUser,
+	redactor *redact.Redactor,
+	mask bool,
+) []map[string]string {
+	domainNames := map[string]string{}
+	for _, authDomain := range authDomains {
+		domainNames[authDomain.Id] = authDomain.Name
+	}
+
+	var masker *redact.Redactor
+	if mask {
+		masker, _ = redact.NewRedactor("", map[string]string{
+			config.EXPORT_COLUMN_NAME:  redact.ACTION_MASK,
+			config.EXPORT_COLUMN_EMAIL: redact.ACTION_MASK,
+		})
+	}
+
+	rows := make([]map[string]string, 0, len(authDomainUsers))
+	for _, user := range authDomainUsers {
+		lastActive := ""
+		if t, ok := parseLastActive(user.LastActive); ok {
+			lastActive = t.UTC().Format(time.RFC3339)
+		}
+		row := redactExportRow(redactor, map[string]string{
+			config.EXPORT_COLUMN_DOMAIN_NAME:        domainNames[user.AuthDomainId],
+			config.EXPORT_COLUMN_USER_ID:            user.Id,
+			config.EXPORT_COLUMN_NAME:               user.Name,
+			config.EXPORT_COLUMN_EMAIL:              user.Email,
+			config.EXPORT_COLUMN_TYPE:               user.UserTypeName,
+			config.EXPORT_COLUMN_VERIFICATION_STATE: user.EmailVerificationState,
+			config.EXPORT_COLUMN_LAST_ACTIVE:        lastActive,
+			config.EXPORT_COLUMN_TIME_ZONE:          user.TimeZone,
+		})
+		rows = append(rows, masker.Apply(row))
+	}
+	return rows
+}
+
+// redactExportRow applies the redactor to the row by the attribute
+// names of its columns.
+func redactExportRow(
+	redactor *redact.Redactor,
+	row map[string]string,
+) map[string]string {
+	attributes := make(map[string]string, len(row))
+	for column, val := range row {
+		attributes[exportColumnAttributes[column]] = val
+	}
+	attributes = redactor.Apply(attributes)
+
+	redacted := make(map[string]string, len(row))
+	for column := range row {
+		if val, ok := attributes[exportColumnAttributes[column]]; ok {
+			redacted[column] = val
+		}
+	}
+	return redacted
+}
+
+// sortExportRows sorts the rows by the given column which is
+// descending with a leading minus. Numeric values are compared as
+// numbers. Without a column the order of the fetch is kept.
+func sortExportRows(
+	rows []map[string]string,
+	sortBy string,
+) {
+	if sortBy == "" {
+		return
+	}
+	descending := strings.HasPrefix(sortBy, "-")
+	column := strings.TrimPrefix(sortBy, "-")
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i][column], rows[j][column]
+		if descending {
+			a, b = b, a
+		}
+		na, errA := strconv.ParseInt(a, 10, 64)
+		nb, errB := strconv.ParseInt(b, 10, 64)
+		if errA == nil && errB == nil {
+			return na < nb
+		}
+		return a < b
+	})
+}
+
+// writeExport writes the header and the rows in a form which
+// spreadsheet applications open as is: UTF-8 with BOM, CRLF line
+// endings and no cells which would be evaluated as formulas.
+func writeExport(
+	w io.Writer,
+	columns []string,
+	rows []map[string]string,
+) error {
+	_, err := io.WriteString(w, utf8Bom)
+	if err != nil {
+		return errors.New(USERS_EXPORT_COULD_NOT_BE_WRITTEN + ": " + err.Error())
+	}
+
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	cw.Write(columns)
+	for _, row := range rows {
+		record := make([]string, 0, len(columns))
+		for _, column := range columns {
+			record = append(record, escapeFormula(row[column]))
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+
+	err = cw.Error()
+	if err != nil {
+		return errors.New(USERS_EXPORT_COULD_NOT_BE_WRITTEN + ": " + err.Error())
+	}
+	return nil
+}
+
+// escapeFormula prefixes the values which spreadsheets would
+// interpret as formulas with a quote.
+func escapeFormula(
+	val string,
+) string {
+	if val != "" && strings.ContainsAny(val[:1], "=+-@\t\r") {
+		return "'" + val
+	}
+	return val
+}
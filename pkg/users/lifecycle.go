@@ -0,0 +1,205 @@
+package users
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+const (
+	LIFECYCLE_USER_ADDED         = "user.added"
+	LIFECYCLE_USER_REMOVED       = "user.removed"
+	LIFECYCLE_USER_TYPE_CHANGED  = "user.typeChanged"
+	LIFECYCLE_USER_EMAIL_CHANGED = "user.emailChanged"
+	LIFECYCLE_USER_DOMAIN_MOVED  = "user.domainMoved"
+)
+
+const snapshotName = "users-snapshot"
+
+// snapshot is the state of the users of the previous run which the
+// current users are compared against.
+type snapshot struct {
+	Users []snapshotUser `json:"users"`
+}
+
+// snapshotUser holds only what the comparison needs so that the
+// state does not keep the names and emails of the users. The email
+// is hashed after it has been lowercased.
+type snapshotUser struct {
+	Id           string `json:"id"`
+	AuthDomainId string `json:"authenticationDomainId"`
+	UserType     string `json:"userType"`
+	EmailHash    string `json:"emailHash"`
+
+	// Email is only read from the snapshots which have been saved
+	// before the emails were hashed.
+	Email string `json:"email,omitempty"`
+}
+
+func newSnapshot(
+	authDomainUsers []authDomainUser,
+) *snapshot {
+	users := make([]snapshotUser, 0, len(authDomainUsers))
+	for _, user := range authDomainUsers {
+		users = append(users, snapshotUser{
+			Id:           user.Id,
+			AuthDomainId: user.AuthDomainId,
+			UserType:     user.UserType,
+			EmailHash:    hashEmail(user.Email),
+		})
+	}
+	return &snapshot{
+		Users: users,
+	}
+}
+
+// getEmailHash returns the hashed email of the user, also for the
+// users of the snapshots which hold the plain email.
+func (s *snapshotUser) getEmailHash() string {
+	if s.EmailHash == "" {
+		return hashEmail(s.Email)
+	}
+	return s.EmailHash
+}
+
+// hashEmail returns the hash of the lowercased email. A missing
+// email stays empty so that it does not match other users.
+func hashEmail(
+	email string,
+) string {
+	if email == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(strings.ToLower(email)))
+	return hex.EncodeToString(hash[:])
+}
+
+// lifecycleEvent is a change of a user between two runs. Previous
+// and current hold the changed value, if any.
+type lifecycleEvent struct {
+	Type     string
+	User     authDomainUser
+	Previous string
+	Current  string
+}
+
+// diffSnapshots compares the users of the previous and the current
+// run. Users are matched by their ID first. A removed and an added
+// user with the same email in different domains are considered to
+// have moved since moving a user creates a new ID. The removed users
+// and the previous values are only known as far as the snapshot
+// holds them.
+func diffSnapshots(
+	previous []snapshotUser,
+	current []authDomainUser,
+) []lifecycleEvent {
+	previousById := make(map[string]snapshotUser, len(previous))
+	for _, user := range previous {
+		previousById[user.Id] = user
+	}
+	currentById := make(map[string]authDomainUser, len(current))
+	for _, user := range current {
+		currentById[user.Id] = user
+	}
+
+	events := make([]lifecycleEvent, 0)
+	added := make([]authDomainUser, 0)
+	for _, user := range current {
+		prev, ok := previousById[user.Id]
+		if !ok {
+			added = append(added, user)
+			continue
+		}
+		events = append(events, diffUser(prev, user)...)
+	}
+
+	removedByEmail := make(map[string]snapshotUser)
+	removed := make([]snapshotUser, 0)
+	for _, user := range previous {
+		if _, ok := currentById[user.Id]; ok {
+			continue
+		}
+		removed = append(removed, user)
+		if emailHash := user.getEmailHash(); emailHash != "" {
+			removedByEmail[emailHash] = user
+		}
+	}
+
+	// Pair the users which have moved to another domain
+	moved := make(map[string]struct{})
+	for _, user := range added {
+		emailHash := hashEmail(user.Email)
+		prev, ok := removedByEmail[emailHash]
+		if ok && emailHash != "" && prev.AuthDomainId != user.AuthDomainId {
+			moved[prev.Id] = struct{}{}
+			events = append(events, lifecycleEvent{
+				Type:     LIFECYCLE_USER_DOMAIN_MOVED,
+				User:     user,
+				Previous: prev.AuthDomainId,
+				Current:  user.AuthDomainId,
+			})
+			delete(removedByEmail, emailHash)
+			continue
+		}
+		events = append(events, lifecycleEvent{
+			Type: LIFECYCLE_USER_ADDED,
+			User: user,
+		})
+	}
+	for _, user := range removed {
+		if _, ok := moved[user.Id]; ok {
+			continue
+		}
+		events = append(events, lifecycleEvent{
+			Type: LIFECYCLE_USER_REMOVED,
+			User: authDomainUser{
+				AuthDomainId: user.AuthDomainId,
+				Id:           user.Id,
+				UserType:     user.UserType,
+			},
+		})
+	}
+
+	// Keep the events in a stable order
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].User.Id != events[j].User.Id {
+			return events[i].User.Id < events[j].User.Id
+		}
+		return events[i].Type < events[j].Type
+	})
+	return events
+}
+
+// diffUser returns the changes of a user. The previous email is not
+// known, so an email change only carries the current one.
+func diffUser(
+	previous snapshotUser,
+	current authDomainUser,
+) []lifecycleEvent {
+	events := make([]lifecycleEvent, 0)
+	if previous.UserType != current.UserType {
+		events = append(events, lifecycleEvent{
+			Type:     LIFECYCLE_USER_TYPE_CHANGED,
+			User:     current,
+			Previous: previous.UserType,
+			Current:  current.UserType,
+		})
+	}
+	if previous.getEmailHash() != hashEmail(current.Email) {
+		events = append(events, lifecycleEvent{
+			Type:    LIFECYCLE_USER_EMAIL_CHANGED,
+			User:    current,
+			Current: current.Email,
+		})
+	}
+	if previous.AuthDomainId != current.AuthDomainId {
+		events = append(events, lifecycleEvent{
+			Type:     LIFECYCLE_USER_DOMAIN_MOVED,
+			User:     current,
+			Previous: previous.AuthDomainId,
+			Current:  current.AuthDomainId,
+		})
+	}
+	return events
+}
@@ -0,0 +1,86 @@
+package users
+
+import (
+	"errors"
+	"strconv"
+)
+
+const (
+	USERS_CURSOR_IS_REPEATED          = "cursor is repeated"
+	USERS_MAX_PAGES_ARE_EXCEEDED      = "max pages are exceeded"
+	USERS_AUTH_DOMAIN_IS_NOT_RETURNED = "auth domain is not returned"
+)
+
+// cursorIterator walks through the pages of a cursor based GraphQL
+// connection. It stops with an error if a cursor is returned twice
+// or if the max pages are exceeded so that a misbehaving API cannot
+// cause an infinite loop.
+type cursorIterator struct {
+	maxPages int
+	cursor   *string
+	seen     map[string]struct{}
+	pages    int
+}
+
+// newCursorIterator creates an iterator with the max pages of the
+// config which are validated to be positive.
+func newCursorIterator(
+	maxPages int,
+) *cursorIterator {
+	return &cursorIterator{
+		maxPages: maxPages,
+		seen:     map[string]struct{}{},
+	}
+}
+
+// startAt continues a connection of which the first pages are
+// already fetched.
+func (it *cursorIterator) startAt(
+	cursor *string,
+) *cursorIterator {
+	it.cursor = cursor
+	if cursor != nil {
+		it.seen[*cursor] = struct{}{}
+	}
+	return it
+}
+
+// forEachPage calls the given function with the cursor of every page
+// until the function returns no next cursor.
+func (it *cursorIterator) forEachPage(
+	fetchPage func(cursor string) (*string, error),
+) error {
+	for {
+		nextCursor, err := fetchPage(setNextCursor(it.cursor))
+		if err != nil {
+			return err
+		}
+		it.pages++
+
+		// Stop when cursor is null
+		if nextCursor == nil {
+			return nil
+		}
+
+		if _, ok := it.seen[*nextCursor]; ok {
+			return errors.New(USERS_CURSOR_IS_REPEATED + ": " + *nextCursor)
+		}
+		if it.pages >= it.maxPages {
+			return errors.New(USERS_MAX_PAGES_ARE_EXCEEDED + ": " + strconv.Itoa(it.maxPages))
+		}
+
+		it.seen[*nextCursor] = struct{}{}
+		it.cursor = nextCursor
+	}
+}
+
+// setNextCursor returns the GraphQL literal of the given cursor
+// which is substituted into the queries as it is.
+func setNextCursor(
+	nextCursor *string,
+) string {
+	if nextCursor == nil {
+		return "null"
+	}
+	return strconv.Quote(*nextCursor)
+}
@@ -0,0 +1,29 @@
+package users
+
+const USER_TYPE_UNKNOWN = "unknown"
+
+// userTypeNames are the names of the known user types. They are
+// preferred over the display names which may change over time.
+var userTypeNames = map[string]string{
+	"0": "basic",
+	"1": "fullPlatform",
+	"2": "core",
+}
+
+// resolveUserTypeName returns the name of the known user type or
+// the display name for the types which are not known yet.
+func resolveUserTypeName(
+	userTypeId string,
+	displayName string,
+) (
+	string,
+	bool,
+) {
+	if name, ok := userTypeNames[userTypeId]; ok {
+		return name, true
+	}
+	if displayName != "" {
+		return displayName, false
+	}
+	return USER_TYPE_UNKNOWN, false
+}
@@ -1,22 +1,41 @@
 package users
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
-	"strings"
+	"sync/atomic"
+	"time"
 
-	fetch "github.com/utr1903/newrelic-tracker-internal/fetch"
+	"github.com/sirupsen/logrus"
 	flush "github.com/utr1903/newrelic-tracker-internal/flush"
-	graphql "github.com/utr1903/newrelic-tracker-internal/graphql"
 	logging "github.com/utr1903/newrelic-tracker-internal/logging"
-	metrics "github.com/utr1903/newrelic-tracker-internal/metrics"
+	"github.com/utr1903/newrelic-tracker-user/pkg/config"
+	"github.com/utr1903/newrelic-tracker-user/pkg/graphql/client"
+	"github.com/utr1903/newrelic-tracker-user/pkg/graphql/gqlerror"
 	"github.com/utr1903/newrelic-tracker-user/pkg/graphql/user"
+	"github.com/utr1903/newrelic-tracker-user/pkg/metrics"
+	"github.com/utr1903/newrelic-tracker-user/pkg/ratelimit"
+	"github.com/utr1903/newrelic-tracker-user/pkg/redact"
+	"github.com/utr1903/newrelic-tracker-user/pkg/retry"
+	"github.com/utr1903/newrelic-tracker-user/pkg/sink"
+	"github.com/utr1903/newrelic-tracker-user/pkg/state"
+	"github.com/utr1903/newrelic-tracker-user/pkg/tracker"
+	"github.com/utr1903/newrelic-tracker-user/pkg/workerpool"
 )
 
 const (
-	USERS_GRAPHQL_HAS_RETURNED_ERRORS = "graphql has returned errors"
-	USERS_LOGS_COULD_NOT_BE_FORWARDED = "logs could not be forwarded"
+	USERS_GRAPHQL_HAS_RETURNED_ERRORS             = "graphql has returned errors"
+	USERS_LOGS_COULD_NOT_BE_FORWARDED             = "logs could not be forwarded"
+	USERS_SNAPSHOT_IS_NOT_FOUND                   = "snapshot is not found, saving the current users as baseline"
+	USERS_SNAPSHOT_IS_SKIPPED                     = "users are partial, skipping the lifecycle changes and the snapshot"
+	USERS_LIFECYCLE_EVENTS_ARE_DETECTED           = "lifecycle events are detected"
+	USERS_LIFECYCLE_EVENTS_COULD_NOT_BE_FORWARDED = "lifecycle events could not be forwarded"
+	USERS_USER_TYPE_IS_UNKNOWN                    = "user type is unknown"
+	USERS_USER_TYPE_ID_IS_NOT_NUMERIC             = "user type ID is not numeric"
 )
 
 const queryTemplateDomains = `
@@ -28,6 +47,7 @@ const queryTemplateDomains = `
 					nextCursor
 					authenticationDomains {
 						id
+						name
 					}
 				}
 			}
@@ -57,6 +77,7 @@ const queryTemplateUsers = `
                 lastActive
 								type {
 									id
+									displayName
 								}
 							}
 						}
@@ -84,6 +105,7 @@ type authDomainUser struct {
 	Id                     string `json:"id"`
 	Name                   string `json:"name"`
 	UserType               string `json:"userType"`
+	UserTypeName           string `json:"userTypeName"`
 	Email                  string `json:"email"`
 	EmailVerificationState string `json:"emailVerificationState"`
 	LastActive             string `json:"lastActive"`
@@ -91,46 +113,103 @@ type authDomainUser struct {
 }
 
 type Users struct {
-	OrganizationId  string
-	Logger          logging.ILogger
-	GqlcDomains     graphql.IGraphQlClient
-	GqlcUsers       graphql.IGraphQlClient
-	MetricForwarder metrics.IMetricForwarder
+	OrganizationId     string
+	Logger             logging.ILogger
+	StateStore         state.IStore
+	GqlcDomains        client.IGraphQlClient
+	GqlcDomainSettings client.IGraphQlClient
+	GqlcUsers          client.IGraphQlClient
+	GqlcGroups         client.IGraphQlClient
+	GqlcGroupMembers   client.IGraphQlClient
+	GqlcRoles          client.IGraphQlClient
+	GqlcGroupRoles     client.IGraphQlClient
+	Sink               sink.ISink
+	Workers            int
+	MaxPages           int
+	CollectAccess      bool
+	Inactivity         config.Inactivity
+	Timeouts           config.Timeouts
+	Redactor           *redact.Redactor
+
+	// partial is set once a page of the current run has returned
+	// GraphQL errors next to its data.
+	partial atomic.Bool
 }
 
 func NewUsers(
-	organizationId string,
+	cfg *config.Config,
+	limiter *ratelimit.Limiter,
 ) *Users {
-	logger := logging.NewLoggerWithForwarder(
-		"DEBUG",
-		os.Getenv("NEWRELIC_LICENSE_KEY"),
-		"https://log-api.eu.newrelic.com/log/v1",
-		setCommonAttributes(organizationId),
-	)
-	gqlcDomains := graphql.NewGraphQlClient(
-		logger,
-		"https://api.eu.newrelic.com/graphql",
-		trackedAttributeType,
-		queryTemplateDomains,
-	)
-	gqlcUsers := graphql.NewGraphQlClient(
-		logger,
-		"https://api.eu.newrelic.com/graphql",
-		trackedAttributeType,
-		queryTemplateUsers,
-	)
+	logger := tracker.NewSyncLogger(logging.NewLoggerWithForwarder(
+		cfg.LogLevel,
+		cfg.LicenseKey,
+		cfg.Endpoints.Logs,
+		setCommonAttributes(cfg.OrganizationId),
+	))
+	return newUsers(cfg, limiter, logger)
+}
+
+// NewUsersExport creates the users for the export command which
+// logs to the standard error so that the standard output only
+// carries the inventory.
+func NewUsersExport(
+	cfg *config.Config,
+	limiter *ratelimit.Limiter,
+) *Users {
+	logger := tracker.NewSyncLogger(tracker.NewLocalLogger(
+		cfg.LogLevel,
+		os.Stderr,
+	))
+	return newUsers(cfg, limiter, logger)
+}
+
+func newUsers(
+	cfg *config.Config,
+	limiter *ratelimit.Limiter,
+	logger logging.ILogger,
+) *Users {
+	retrier := retry.NewRetrier(logger, retry.NewPolicy(cfg.Users.Retry))
+	newGraphQlClient := func(queryTemplate string) client.IGraphQlClient {
+		gqlc := client.NewGraphQlClient(
+			logger,
+			cfg.Endpoints.GraphQl,
+			cfg.ApiKey,
+			trackedAttributeType,
+			queryTemplate,
+		)
+		return retry.NewGraphQlClient(ratelimit.NewGraphQlClient(gqlc, limiter), retrier)
+	}
+	// Lifecycle events are always forwarded regardless of the log level
+	eventLogger := tracker.NewSyncLogger(logging.NewLoggerWithForwarder(
+		config.LOG_LEVEL_DEBUG,
+		cfg.LicenseKey,
+		cfg.Endpoints.Logs,
+		setLifecycleAttributes(cfg.OrganizationId),
+	))
 	mf := metrics.NewMetricForwarder(
 		logger,
-		os.Getenv("NEWRELIC_LICENSE_KEY"),
-		"https://metric-api.eu.newrelic.com/metric/v1",
-		setCommonAttributes(organizationId),
+		cfg.LicenseKey,
+		cfg.Endpoints.Metrics,
+		setCommonAttributes(cfg.OrganizationId),
 	)
 	return &Users{
-		OrganizationId:  organizationId,
-		Logger:          logger,
-		GqlcDomains:     gqlcDomains,
-		GqlcUsers:       gqlcUsers,
-		MetricForwarder: mf,
+		OrganizationId:     cfg.OrganizationId,
+		Logger:             logger,
+		StateStore:         state.NewStore(cfg.StateDir),
+		GqlcDomains:        newGraphQlClient(queryTemplateDomains),
+		GqlcDomainSettings: newGraphQlClient(queryTemplateDomainSettings),
+		GqlcUsers:          newGraphQlClient(queryTemplateUsers),
+		GqlcGroups:         newGraphQlClient(queryTemplateGroups),
+		GqlcGroupMembers:   newGraphQlClient(queryTemplateGroupMembers),
+		GqlcRoles:          newGraphQlClient(queryTemplateRoles),
+		GqlcGroupRoles:     newGraphQlClient(queryTemplateGroupRoles),
+		Sink:               sink.NewSink(cfg, sink.NewNewRelic(retry.NewMetricForwarder(mf, retrier), nil, eventLogger)),
+		Workers:            cfg.Users.Workers,
+		MaxPages:           cfg.Users.MaxPages,
+		CollectAccess:      cfg.Users.CollectAccess,
+		Inactivity:         cfg.Users.Inactivity,
+		Timeouts:           cfg.Timeouts,
+		Redactor:           cfg.Redactor(),
 	}
 }
 
@@ -143,114 +222,220 @@ func setCommonAttributes(
 	}
 }
 
-func (u *Users) Run() error {
+func setLifecycleAttributes(
+	organizationId string,
+) map[string]string {
+	attributes := setCommonAttributes(organizationId)
+	attributes["tracker.logType"] = "lifecycle"
+	return attributes
+}
 
-	// Fetch the domain IDs per GraphQL
-	authDomainIds, err := u.fetchDomainIds()
+func (u *Users) Run(
+	ctx context.Context,
+) error {
+	runTimeout := u.Timeouts.Run.Duration()
+	ctx, cancel := tracker.WithTimeout(ctx, runTimeout)
+	defer cancel()
+	u.partial.Store(false)
+
+	// Fetch the domains, users & their access per GraphQL
+	var authDomains []authDomain
+	var authDomainUsers []authDomainUser
+	var groups []group
+	err := tracker.RunPhase(ctx, tracker.PHASE_FETCH, u.Timeouts.Fetch.Duration(), runTimeout,
+		func(ctx context.Context) error {
+			var err error
+			authDomains, err = u.fetchDomains(ctx)
+			if err != nil {
+				return err
+			}
+			u.fetchDomainSettings(ctx, authDomains)
+			authDomainIds := getAuthDomainIds(authDomains)
+			authDomainUsers, err = u.fetchUsers(ctx, authDomainIds)
+			if err != nil {
+				return err
+			}
+			if u.CollectAccess {
+				groups, err = u.fetchAccess(ctx, authDomainIds)
+			}
+			return err
+		})
 	if err != nil {
 		return err
 	}
 
-	// Fetch the users per GraphQL
-	authDomainUsers, err := u.fetchUsers(authDomainIds)
+	// Create & flush metrics
+	err = tracker.RunPhase(ctx, tracker.PHASE_FLUSH_METRICS, u.Timeouts.FlushMetrics.Duration(), runTimeout,
+		func(ctx context.Context) error {
+			return u.flushMetrics(ctx, authDomains, authDomainUsers, groups)
+		})
 	if err != nil {
 		return err
 	}
 
-	// Create & flush metrics
-	err = u.flushMetrics(authDomainUsers)
+	// Detect the changes since the previous run
+	err = u.trackLifecycle(ctx, runTimeout, authDomainUsers)
 	if err != nil {
 		return err
 	}
 
+	// Write the records which are held back until the snapshot is saved
+	err = sink.Commit(u.Sink)
+	if err != nil {
+		return tracker.Wrap(tracker.PHASE_FLUSH_METRICS, err)
+	}
+
 	// Flush logs
-	u.flushLogs()
+	u.flushLogs(ctx, runTimeout)
 
 	return nil
 }
 
-func (u *Users) fetchDomainIds() (
-	[]string,
+// checkErrors logs the GraphQL errors of a page and fails if the page
+// has no data. A page with data is accepted but marks the run as
+// partial.
+func (u *Users) checkErrors(
+	attributes map[string]string,
+	errs gqlerror.GraphQlErrors,
+	hasData bool,
+) error {
+	err := gqlerror.Check(u.Logger, USERS_GRAPHQL_HAS_RETURNED_ERRORS, attributes, errs, hasData)
+	if err != nil {
+		return fmt.Errorf("%s: %w", USERS_GRAPHQL_HAS_RETURNED_ERRORS, err)
+	}
+	if len(errs) != 0 {
+		u.partial.Store(true)
+	}
+	return nil
+}
+
+func (u *Users) fetchDomains(
+	ctx context.Context,
+) (
+	[]authDomain,
 	error,
 ) {
-	var cursor *string = nil
-	authDomainIds := make([]string, 0)
+	authDomains := make([]authDomain, 0)
 
 	// Loop until fetching all domains in the organization
-	for {
-
-		qv := &queryVariablesDomains{
-			Cursor: setNextCursor(cursor),
-		}
+	err := newCursorIterator(u.MaxPages).forEachPage(
+		func(cursor string) (*string, error) {
+			qv := &queryVariablesDomains{
+				Cursor: cursor,
+			}
 
-		res := &user.GraphQlUserResponse{}
-		err := fetch.Fetch(
-			u.GqlcDomains,
-			qv,
-			res,
-		)
-		if err != nil {
-			return nil, err
-		}
+			res := &user.GraphQlUserResponse{}
+			err := u.GqlcDomains.Execute(ctx, qv, res)
+			if err != nil {
+				return nil, err
+			}
 
-		// Get the auth domain
-		authDomain := res.GetAuthDomains()
+			// Get the auth domain
+			authDomain := res.GetAuthDomains()
+			err = u.checkErrors(
+				map[string]string{
+					"tracker.package": "pkg.users",
+					"tracker.file":    "users.go",
+				},
+				res.Errors,
+				authDomain.AuthenticationDomains != nil,
+			)
+			if err != nil {
+				return nil, err
+			}
 
-		// Add domain Ids
-		for _, domain := range authDomain.AuthenticationDomains {
-			authDomainIds = append(authDomainIds, domain.Id)
-		}
+			// Add domains
+			for _, domain := range authDomain.AuthenticationDomains {
+				authDomains = append(authDomains, newAuthDomain(domain))
+			}
 
-		// Continue to fetch domains until cursor is null
-		cursor = authDomain.NextCursor
-		if cursor == nil {
-			break
-		}
+			return authDomain.NextCursor, nil
+		})
+	if err != nil {
+		return nil, err
 	}
-	return authDomainIds, nil
+	return authDomains, nil
 }
 
+// fetchUsers fetches the users of all domains concurrently with a
+// bounded number of workers. The users are returned in the order of
+// the given domains.
 func (u *Users) fetchUsers(
+	ctx context.Context,
 	authDomainIds []string,
 ) (
 	[]authDomainUser,
 	error,
 ) {
+	usersPerDomain := make([][]authDomainUser, len(authDomainIds))
+	err := workerpool.ForEachFailFast(ctx, u.Workers, len(authDomainIds),
+		func(ctx context.Context, i int) error {
+			var err error
+			usersPerDomain[i], err = u.fetchDomainUsers(ctx, authDomainIds[i])
+			return err
+		})
+	if err != nil {
+		return nil, err
+	}
 
-	var cursorUser *string = nil
 	authDomainUsers := make([]authDomainUser, 0)
+	for _, domainUsers := range usersPerDomain {
+		authDomainUsers = append(authDomainUsers, domainUsers...)
+	}
+	return authDomainUsers, nil
+}
 
-	// Loop over all auth domains
-	for _, authDomainId := range authDomainIds {
-
-		// Loop until fetching all users in a domain
-		for {
+func (u *Users) fetchDomainUsers(
+	ctx context.Context,
+	authDomainId string,
+) (
+	[]authDomainUser,
+	error,
+) {
+	authDomainUsers := make([]authDomainUser, 0)
 
+	// Loop until fetching all users in the domain
+	err := newCursorIterator(u.MaxPages).forEachPage(
+		func(cursor string) (*string, error) {
 			qv := &queryVariablesUsers{
 				AuthDomainId: authDomainId,
-				Cursor:       setNextCursor(cursorUser),
+				Cursor:       cursor,
 			}
 
 			res := &user.GraphQlUserResponse{}
-			err := fetch.Fetch(
-				u.GqlcUsers,
-				qv,
-				res,
-			)
+			err := u.GqlcUsers.Execute(ctx, qv, res)
 			if err != nil {
 				return nil, err
 			}
 
 			// Get the auth domain
-			authDomain := res.GetAuthDomains().AuthenticationDomains[0]
+			authDomains := res.GetAuthDomains().AuthenticationDomains
+			err = u.checkErrors(
+				map[string]string{
+					"tracker.package":      "pkg.users",
+					"tracker.file":         "users.go",
+					"tracker.authDomainId": authDomainId,
+				},
+				res.Errors,
+				len(authDomains) != 0,
+			)
+			if err != nil {
+				return nil, err
+			}
+			if len(authDomains) == 0 {
+				return nil, errors.New(USERS_AUTH_DOMAIN_IS_NOT_RETURNED + ": " + authDomainId)
+			}
+			authDomain := authDomains[0]
 
 			// Add users
 			for _, user := range authDomain.Users.Users {
+				userTypeName, _ := resolveUserTypeName(user.UserType.Id, user.UserType.DisplayName)
 				authDomainUsers = append(authDomainUsers, authDomainUser{
 					AuthDomainId:           authDomain.Id,
 					Id:                     user.Id,
 					Name:                   user.Name,
 					UserType:               user.UserType.Id,
+					UserTypeName:           userTypeName,
 					Email:                  user.Email,
 					EmailVerificationState: user.EmailVerificationState,
 					LastActive:             user.LastActive,
@@ -258,56 +443,247 @@ func (u *Users) fetchUsers(
 				})
 			}
 
-			// Continue to fetch users until cursor is null
-			cursorUser = authDomain.Users.NextCursor
-			if cursorUser == nil {
-				break
+			return authDomain.Users.NextCursor, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return authDomainUsers, nil
+}
+
+func (u *Users) flushMetrics(
+	ctx context.Context,
+	authDomains []authDomain,
+	authDomainUsers []authDomainUser,
+	groups []group,
+) error {
+	classifier := newActivityClassifier(u.Inactivity, time.Now())
+	activityCounts := map[string]map[string]int{}
+	typeNames := map[string]string{}
+
+	metrics := []flush.FlushMetric{}
+	for _, user := range authDomainUsers {
+		activity, inactiveDays, hasBeenActive := classifier.classify(user.LastActive)
+		attributes := map[string]string{
+			"tracker.users.authDomainId":           user.AuthDomainId,
+			"tracker.users.id":                     user.Id,
+			"tracker.users.name":                   user.Name,
+			"tracker.users.email":                  user.Email,
+			"tracker.users.emailVerificationState": user.EmailVerificationState,
+			"tracker.users.lastActive":             user.LastActive,
+			"tracker.users.timeZone":               user.TimeZone,
+			"tracker.users.activity":               activity,
+			"tracker.users.typeName":               user.UserTypeName,
+		}
+
+		// Report every unknown or malformed type once
+		_, reported := typeNames[user.UserType]
+		typeNames[user.UserType] = user.UserTypeName
+		userType, err := strconv.ParseFloat(user.UserType, 64)
+		if err != nil {
+			if !reported {
+				u.logUserType(logrus.ErrorLevel, USERS_USER_TYPE_ID_IS_NOT_NUMERIC, user)
+			}
+		} else {
+			if _, known := userTypeNames[user.UserType]; !known && !reported {
+				u.logUserType(logrus.DebugLevel, USERS_USER_TYPE_IS_UNKNOWN, user)
 			}
+			metrics = append(metrics, flush.FlushMetric{
+				Name:       "tracker.users.type",
+				Value:      userType,
+				Attributes: attributes,
+			})
 		}
+		if hasBeenActive {
+			metrics = append(metrics, flush.FlushMetric{
+				Name:       "tracker.users.inactiveDays",
+				Value:      float64(inactiveDays),
+				Attributes: attributes,
+			})
+		}
+
+		if _, ok := activityCounts[user.UserType]; !ok {
+			activityCounts[user.UserType] = map[string]int{}
+		}
+		activityCounts[user.UserType][activity]++
 	}
-	return authDomainUsers, nil
+	metrics = append(metrics, createActivityCountMetrics(activityCounts, typeNames)...)
+	metrics = append(metrics, createSeatMetrics(authDomainUsers)...)
+	metrics = append(metrics, createAccessMetrics(authDomainUsers, groups)...)
+	metrics = append(metrics, createDomainMetrics(authDomains)...)
+
+	records := sink.FromMetrics(metrics)
+	records = append(records, createRoleGrantRecords(authDomainUsers, groups)...)
+	err := u.Sink.Write(ctx, records)
+	if err != nil {
+		return err
+	}
+
+	return nil
 }
 
-func setNextCursor(
-	nextCursor *string,
-) string {
-	if nextCursor == nil {
-		return "null"
+func (u *Users) logUserType(
+	lvl logrus.Level,
+	msg string,
+	user authDomainUser,
+) {
+	u.Logger.LogWithFields(lvl, msg,
+		map[string]string{
+			"tracker.package":        "pkg.users",
+			"tracker.file":           "users.go",
+			"tracker.users.type":     user.UserType,
+			"tracker.users.typeName": user.UserTypeName,
+		})
+}
+
+// createActivityCountMetrics creates the number of users per user
+// type and activity bucket. Empty buckets are reported as zero.
+func createActivityCountMetrics(
+	activityCounts map[string]map[string]int,
+	typeNames map[string]string,
+) []flush.FlushMetric {
+	userTypes := make([]string, 0, len(activityCounts))
+	for userType := range activityCounts {
+		userTypes = append(userTypes, userType)
+	}
+	sort.Strings(userTypes)
+
+	metrics := make([]flush.FlushMetric, 0)
+	for _, userType := range userTypes {
+		for _, activity := range []string{
+			ACTIVITY_ACTIVE,
+			ACTIVITY_IDLE,
+			ACTIVITY_DORMANT,
+			ACTIVITY_NEVER_LOGGED_IN,
+		} {
+			metrics = append(metrics, flush.FlushMetric{
+				Name:  "tracker.users.activity.count",
+				Value: float64(activityCounts[userType][activity]),
+				Attributes: map[string]string{
+					"tracker.users.type":     userType,
+					"tracker.users.typeName": typeNames[userType],
+					"tracker.users.activity": activity,
+				},
+			})
+		}
 	}
-	cursor := strings.Clone(*nextCursor)
-	return cursor
+	return metrics
 }
 
-func (u *Users) flushMetrics(
+// trackLifecycle emits the lifecycle events of the users compared to
+// the snapshot of the previous run and saves the current snapshot.
+// The snapshot is only replaced once the events are forwarded and
+// is kept as it is if the users of the run are partial.
+func (u *Users) trackLifecycle(
+	ctx context.Context,
+	runTimeout time.Duration,
 	authDomainUsers []authDomainUser,
 ) error {
-	metrics := []flush.FlushMetric{}
-	for _, user := range authDomainUsers {
-		userType, _ := strconv.ParseFloat(user.UserType, 64)
-		metrics = append(metrics, flush.FlushMetric{
-			Name:  "tracker.users.type",
-			Value: userType,
-			Attributes: map[string]string{
-				"tracker.users.authDomainId":           user.AuthDomainId,
-				"tracker.users.id":                     user.Id,
-				"tracker.users.name":                   user.Name,
-				"tracker.users.email":                  user.Email,
-				"tracker.users.emailVerificationState": user.EmailVerificationState,
-				"tracker.users.lastActive":             user.LastActive,
-				"tracker.users.timeZone":               user.TimeZone,
-			},
+	if u.StateStore == nil {
+		return nil
+	}
+
+	// Users which are missing from a partial page would be reported
+	// as removed, so the previous snapshot is kept for the next run
+	if u.partial.Load() {
+		u.Logger.LogWithFields(logrus.ErrorLevel, USERS_SNAPSHOT_IS_SKIPPED,
+			map[string]string{
+				"tracker.package": "pkg.users",
+				"tracker.file":    "users.go",
+			})
+		return nil
+	}
+
+	previous := &snapshot{}
+	ok, err := u.StateStore.Load(snapshotName, previous)
+	if err != nil {
+		return tracker.Wrap(tracker.PHASE_STATE, err)
+	}
+
+	if ok {
+		events := diffSnapshots(previous.Users, authDomainUsers)
+		err = tracker.RunPhase(ctx, tracker.PHASE_FLUSH_EVENTS, u.Timeouts.FlushEvents.Duration(), runTimeout,
+			func(ctx context.Context) error {
+				return u.flushEvents(ctx, events)
+			})
+		if err != nil {
+			return err
+		}
+	} else {
+		u.Logger.LogWithFields(logrus.DebugLevel, USERS_SNAPSHOT_IS_NOT_FOUND,
+			map[string]string{
+				"tracker.package": "pkg.users",
+				"tracker.file":    "users.go",
+			})
+	}
+
+	err = u.StateStore.Save(snapshotName, newSnapshot(authDomainUsers))
+	if err != nil {
+		return tracker.Wrap(tracker.PHASE_STATE, err)
+	}
+	return nil
+}
+
+func (u *Users) flushEvents(
+	ctx context.Context,
+	events []lifecycleEvent,
+) error {
+	u.Logger.LogWithFields(logrus.DebugLevel, USERS_LIFECYCLE_EVENTS_ARE_DETECTED,
+		map[string]string{
+			"tracker.package": "pkg.users",
+			"tracker.file":    "users.go",
+			"tracker.count":   strconv.Itoa(len(events)),
 		})
+	if len(events) == 0 {
+		return nil
 	}
-	err := flush.Flush(u.MetricForwarder, metrics)
+
+	records := make([]sink.Record, 0, len(events))
+	for _, event := range events {
+		attributes := map[string]string{
+			"tracker.users.event":        event.Type,
+			"tracker.users.authDomainId": event.User.AuthDomainId,
+			"tracker.users.id":           event.User.Id,
+			"tracker.users.name":         event.User.Name,
+			"tracker.users.email":        event.User.Email,
+		}
+
+		// Emails are kept apart so that they are redacted as emails
+		if event.Type == LIFECYCLE_USER_EMAIL_CHANGED {
+			attributes["tracker.users.currentEmail"] = event.Current
+		} else {
+			attributes["tracker.users.previous"] = event.Previous
+			attributes["tracker.users.current"] = event.Current
+		}
+
+		records = append(records, sink.Record{
+			Kind:       sink.KIND_LOG,
+			Name:       event.Type,
+			Attributes: attributes,
+		})
+	}
+
+	err := u.Sink.Write(ctx, records)
 	if err != nil {
+		u.Logger.LogWithFields(logrus.ErrorLevel, USERS_LIFECYCLE_EVENTS_COULD_NOT_BE_FORWARDED,
+			map[string]string{
+				"tracker.package": "pkg.users",
+				"tracker.file":    "users.go",
+				"tracker.error":   err.Error(),
+			})
 		return err
 	}
-
 	return nil
 }
 
-func (u *Users) flushLogs() {
-	err := u.Logger.Flush()
+func (u *Users) flushLogs(
+	ctx context.Context,
+	runTimeout time.Duration,
+) {
+	err := tracker.RunPhase(ctx, tracker.PHASE_FLUSH_LOGS, u.Timeouts.FlushLogs.Duration(), runTimeout,
+		func(ctx context.Context) error {
+			return tracker.Await(ctx, u.Logger.Flush)
+		})
 	if err != nil {
 		fmt.Println(USERS_LOGS_COULD_NOT_BE_FORWARDED, err.Error())
 	}
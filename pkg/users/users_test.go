@@ -1,14 +1,26 @@
 package users
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/utr1903/newrelic-tracker-user/pkg/config"
+	"github.com/utr1903/newrelic-tracker-user/pkg/graphql/gqlerror"
 	"github.com/utr1903/newrelic-tracker-user/pkg/graphql/user"
+	"github.com/utr1903/newrelic-tracker-user/pkg/redact"
+	"github.com/utr1903/newrelic-tracker-user/pkg/sink"
+	"github.com/utr1903/newrelic-tracker-user/pkg/tracker"
 )
 
 const (
@@ -22,6 +34,7 @@ const (
 )
 
 type loggerMock struct {
+	mu   sync.Mutex
 	msgs []string
 }
 
@@ -36,6 +49,8 @@ func (l *loggerMock) LogWithFields(
 	msg string,
 	attributes map[string]string,
 ) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	l.msgs = append(l.msgs, msg)
 }
 
@@ -45,12 +60,19 @@ func (l *loggerMock) Flush() error {
 
 type graphqlClientMockDomains struct {
 	failRequest bool
+	delay       time.Duration
 }
 
 func (c *graphqlClientMockDomains) Execute(
+	ctx context.Context,
 	qv any,
 	result any,
 ) error {
+	select {
+	case <-time.After(c.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 	if c.failRequest {
 		return errors.New("error_fetch_domains")
 	}
@@ -64,7 +86,9 @@ func (c *graphqlClientMockDomains) Execute(
 			NextCursor: &nextCursor,
 			AuthenticationDomains: []user.AuthenticationDomain{
 				{
-					Id: dom1,
+					Id:                 dom1,
+					ProvisioningType:   "SCIM",
+					AuthenticationType: "SAML",
 				},
 			},
 		}
@@ -109,6 +133,7 @@ type graphqlClientMockUsers struct {
 }
 
 func (c *graphqlClientMockUsers) Execute(
+	ctx context.Context,
 	qv any,
 	result any,
 ) error {
@@ -145,7 +170,7 @@ func (c *graphqlClientMockUsers) Execute(
 				},
 			},
 		}
-	} else if qvParsed.Cursor == "notnull" && qvParsed.AuthDomainId == dom1 {
+	} else if qvParsed.Cursor == `"notnull"` && qvParsed.AuthDomainId == dom1 {
 		authDomainsResponse = user.AuthenticationDomains{
 			NextCursor: nil,
 			AuthenticationDomains: []user.AuthenticationDomain{
@@ -194,7 +219,7 @@ func (c *graphqlClientMockUsers) Execute(
 				},
 			},
 		}
-	} else if qvParsed.Cursor == "notnull" && qvParsed.AuthDomainId == dom2 {
+	} else if qvParsed.Cursor == `"notnull"` && qvParsed.AuthDomainId == dom2 {
 		authDomainsResponse = user.AuthenticationDomains{
 			NextCursor: nil,
 			AuthenticationDomains: []user.AuthenticationDomain{
@@ -245,8 +270,15 @@ func (c *graphqlClientMockUsers) Execute(
 	return nil
 }
 
+type metricMock struct {
+	name       string
+	value      float64
+	attributes map[string]string
+}
+
 type metricForwarderMock struct {
 	returnError bool
+	metrics     []metricMock
 }
 
 func (mf *metricForwarderMock) AddMetric(
@@ -256,9 +288,16 @@ func (mf *metricForwarderMock) AddMetric(
 	metricValue float64,
 	metricAttributes map[string]string,
 ) {
+	mf.metrics = append(mf.metrics, metricMock{
+		name:       metricName,
+		value:      metricValue,
+		attributes: metricAttributes,
+	})
 }
 
-func (mf *metricForwarderMock) Run() error {
+func (mf *metricForwarderMock) Run(
+	ctx context.Context,
+) error {
 
 	if mf.returnError {
 		return errors.New("error_flush_metrics")
@@ -279,14 +318,16 @@ func Test_FetchingDomainsFails(t *testing.T) {
 	}
 
 	us := &Users{
-		OrganizationId:  "organizationId",
-		Logger:          logger,
-		GqlcDomains:     gqlcDomains,
-		GqlcUsers:       gqlcUsers,
-		MetricForwarder: mf,
+		OrganizationId:     "organizationId",
+		Logger:             logger,
+		MaxPages:           1000,
+		GqlcDomains:        gqlcDomains,
+		GqlcDomainSettings: &graphqlClientMockDomains{},
+		GqlcUsers:          gqlcUsers,
+		Sink:               sink.NewNewRelic(mf, nil, nil),
 	}
 
-	err := us.Run()
+	err := us.Run(context.Background())
 
 	assert.NotNil(t, err)
 	assert.Equal(t, "error_fetch_domains", err.Error())
@@ -305,18 +346,20 @@ func Test_FetchingDomainsSucceeds(t *testing.T) {
 	}
 
 	us := &Users{
-		OrganizationId:  "organizationId",
-		Logger:          logger,
-		GqlcDomains:     gqlcDomains,
-		GqlcUsers:       gqlcUsers,
-		MetricForwarder: mf,
+		OrganizationId:     "organizationId",
+		Logger:             logger,
+		MaxPages:           1000,
+		GqlcDomains:        gqlcDomains,
+		GqlcDomainSettings: &graphqlClientMockDomains{},
+		GqlcUsers:          gqlcUsers,
+		Sink:               sink.NewNewRelic(mf, nil, nil),
 	}
 
-	authDomainIds, err := us.fetchDomainIds()
+	authDomains, err := us.fetchDomains(context.Background())
 
 	assert.Nil(t, err)
-	assert.Equal(t, dom1, authDomainIds[0])
-	assert.Equal(t, dom2, authDomainIds[1])
+	assert.Equal(t, dom1, authDomains[0].Id)
+	assert.Equal(t, dom2, authDomains[1].Id)
 }
 
 func Test_FetchingUsersFails(t *testing.T) {
@@ -332,14 +375,16 @@ func Test_FetchingUsersFails(t *testing.T) {
 	}
 
 	us := &Users{
-		OrganizationId:  "organizationId",
-		Logger:          logger,
-		GqlcDomains:     gqlcDomains,
-		GqlcUsers:       gqlcUsers,
-		MetricForwarder: mf,
+		OrganizationId:     "organizationId",
+		Logger:             logger,
+		MaxPages:           1000,
+		GqlcDomains:        gqlcDomains,
+		GqlcDomainSettings: &graphqlClientMockDomains{},
+		GqlcUsers:          gqlcUsers,
+		Sink:               sink.NewNewRelic(mf, nil, nil),
 	}
 
-	err := us.Run()
+	err := us.Run(context.Background())
 
 	assert.NotNil(t, err)
 	assert.Equal(t, "error_fetch_users", err.Error())
@@ -358,15 +403,17 @@ func Test_FetchingUsersSucceeds(t *testing.T) {
 	}
 
 	us := &Users{
-		OrganizationId:  "organizationId",
-		Logger:          logger,
-		GqlcDomains:     gqlcDomains,
-		GqlcUsers:       gqlcUsers,
-		MetricForwarder: mf,
+		OrganizationId:     "organizationId",
+		Logger:             logger,
+		MaxPages:           1000,
+		GqlcDomains:        gqlcDomains,
+		GqlcDomainSettings: &graphqlClientMockDomains{},
+		GqlcUsers:          gqlcUsers,
+		Sink:               sink.NewNewRelic(mf, nil, nil),
 	}
 
-	authDomainIds, _ := us.fetchDomainIds()
-	authDomainUsers, err := us.fetchUsers(authDomainIds)
+	authDomains, _ := us.fetchDomains(context.Background())
+	authDomainUsers, err := us.fetchUsers(context.Background(), getAuthDomainIds(authDomains))
 
 	assert.Nil(t, err)
 
@@ -387,6 +434,76 @@ func Test_FetchingUsersSucceeds(t *testing.T) {
 	assert.Equal(t, dom2user2, authDomainUsers[3].Id)
 }
 
+func Test_FetchingTimesOut(t *testing.T) {
+	logger := newLoggerMock()
+	gqlcDomains := &graphqlClientMockDomains{
+		failRequest: false,
+		delay:       100 * time.Millisecond,
+	}
+	gqlcUsers := &graphqlClientMockUsers{
+		failRequest: false,
+	}
+	mf := &metricForwarderMock{
+		returnError: false,
+	}
+
+	us := &Users{
+		OrganizationId:     "organizationId",
+		Logger:             logger,
+		MaxPages:           1000,
+		GqlcDomains:        gqlcDomains,
+		GqlcDomainSettings: &graphqlClientMockDomains{},
+		GqlcUsers:          gqlcUsers,
+		Sink:               sink.NewNewRelic(mf, nil, nil),
+		Timeouts: config.Timeouts{
+			Fetch: config.Duration(10 * time.Millisecond),
+		},
+	}
+
+	err := us.Run(context.Background())
+
+	var timeoutErr *tracker.TimeoutError
+	assert.True(t, errors.As(err, &timeoutErr))
+	assert.Equal(t, tracker.PHASE_FETCH, timeoutErr.Phase)
+
+	phase, _ := tracker.GetPhase(err)
+	assert.Equal(t, tracker.PHASE_FETCH, phase)
+}
+
+func Test_FetchingUsersConcurrentlyKeepsOrder(t *testing.T) {
+	logger := newLoggerMock()
+	gqlcDomains := &graphqlClientMockDomains{
+		failRequest: false,
+	}
+	gqlcUsers := &graphqlClientMockUsers{
+		failRequest: false,
+	}
+	mf := &metricForwarderMock{
+		returnError: false,
+	}
+
+	us := &Users{
+		OrganizationId:     "organizationId",
+		Logger:             logger,
+		MaxPages:           1000,
+		GqlcDomains:        gqlcDomains,
+		GqlcDomainSettings: &graphqlClientMockDomains{},
+		GqlcUsers:          gqlcUsers,
+		Sink:               sink.NewNewRelic(mf, nil, nil),
+		Workers:            4,
+	}
+
+	authDomainIds := []string{dom2, dom1, dom2, dom1}
+	authDomainUsers, err := us.fetchUsers(context.Background(), authDomainIds)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 8, len(authDomainUsers))
+	for i, authDomainId := range authDomainIds {
+		assert.Equal(t, authDomainId, authDomainUsers[2*i].AuthDomainId)
+		assert.Equal(t, authDomainId, authDomainUsers[2*i+1].AuthDomainId)
+	}
+}
+
 func Test_FlushingFails(t *testing.T) {
 	logger := newLoggerMock()
 	gqlcDomains := &graphqlClientMockDomains{
@@ -400,14 +517,16 @@ func Test_FlushingFails(t *testing.T) {
 	}
 
 	us := &Users{
-		OrganizationId:  "organizationId",
-		Logger:          logger,
-		GqlcDomains:     gqlcDomains,
-		GqlcUsers:       gqlcUsers,
-		MetricForwarder: mf,
+		OrganizationId:     "organizationId",
+		Logger:             logger,
+		MaxPages:           1000,
+		GqlcDomains:        gqlcDomains,
+		GqlcDomainSettings: &graphqlClientMockDomains{},
+		GqlcUsers:          gqlcUsers,
+		Sink:               sink.NewNewRelic(mf, nil, nil),
 	}
 
-	err := us.Run()
+	err := us.Run(context.Background())
 
 	assert.NotNil(t, err)
 	assert.Equal(t, "error_flush_metrics", err.Error())
@@ -426,16 +545,856 @@ func Test_FlushingSucceeds(t *testing.T) {
 	}
 
 	us := &Users{
-		OrganizationId:  "organizationId",
-		Logger:          logger,
-		GqlcDomains:     gqlcDomains,
-		GqlcUsers:       gqlcUsers,
-		MetricForwarder: mf,
+		OrganizationId:     "organizationId",
+		Logger:             logger,
+		MaxPages:           1000,
+		GqlcDomains:        gqlcDomains,
+		GqlcDomainSettings: &graphqlClientMockDomains{},
+		GqlcUsers:          gqlcUsers,
+		Sink:               sink.NewNewRelic(mf, nil, nil),
+	}
+
+	err := us.Run(context.Background())
+
+	assert.Nil(t, err)
+}
+
+type pageMock struct {
+	nextCursor *string
+	userIds    []string
+}
+
+// graphqlClientMockPages serves the pages of every domain per cursor.
+type graphqlClientMockPages struct {
+	mu    sync.Mutex
+	pages map[string]map[string]pageMock
+}
+
+func (c *graphqlClientMockPages) Execute(
+	ctx context.Context,
+	qv any,
+	result any,
+) error {
+	qvParsed := parseQueryVariablesUsers(qv)
+
+	c.mu.Lock()
+	page, ok := c.pages[qvParsed.AuthDomainId][qvParsed.Cursor]
+	c.mu.Unlock()
+
+	authDomainsResponse := user.AuthenticationDomains{
+		AuthenticationDomains: []user.AuthenticationDomain{},
+	}
+	if ok {
+		users := make([]user.User, 0)
+		for _, userId := range page.userIds {
+			users = append(users, user.User{
+				Id: userId,
+			})
+		}
+		authDomainsResponse.AuthenticationDomains = append(authDomainsResponse.AuthenticationDomains,
+			user.AuthenticationDomain{
+				Id: qvParsed.AuthDomainId,
+				Users: user.Users{
+					NextCursor: page.nextCursor,
+					Users:      users,
+				},
+			})
+	}
+
+	res := user.GraphQlUserResponse{
+		Data: user.Data{
+			Actor: user.Actor{
+				Organization: user.Organization{
+					UserManagement: user.UserManagement{
+						AuthenticationDomains: authDomainsResponse,
+					},
+				},
+			},
+		},
+	}
+
+	bytes, err := json.Marshal(res)
+	if err != nil {
+		panic(err)
+	}
+
+	err = json.Unmarshal(bytes, result)
+	if err != nil {
+		panic(err)
+	}
+
+	return nil
+}
+
+func cursorOf(
+	cursor string,
+) *string {
+	return &cursor
+}
+
+func Test_MultiPageMultiDomainUsersAreFetched(t *testing.T) {
+	gqlcUsers := &graphqlClientMockPages{
+		pages: map[string]map[string]pageMock{
+			"domA": {
+				"null": {nextCursor: cursorOf("a1"), userIds: []string{"a0"}},
+				`"a1"`: {nextCursor: cursorOf("a2"), userIds: []string{"a1"}},
+				`"a2"`: {nextCursor: nil, userIds: []string{"a2"}},
+			},
+			"domB": {
+				"null": {nextCursor: nil, userIds: []string{"b0"}},
+			},
+			"domC": {
+				"null": {nextCursor: cursorOf("a1"), userIds: []string{"c0"}},
+				`"a1"`: {nextCursor: nil, userIds: []string{"c1"}},
+			},
+		},
+	}
+
+	us := &Users{
+		OrganizationId: "organizationId",
+		Logger:         newLoggerMock(),
+		MaxPages:       1000,
+		GqlcUsers:      gqlcUsers,
+		Workers:        2,
+	}
+
+	authDomainUsers, err := us.fetchUsers(context.Background(), []string{"domA", "domB", "domC"})
+
+	assert.Nil(t, err)
+	userIds := make([]string, 0)
+	for _, authDomainUser := range authDomainUsers {
+		userIds = append(userIds, authDomainUser.Id)
+	}
+	assert.Equal(t, []string{"a0", "a1", "a2", "b0", "c0", "c1"}, userIds)
+}
+
+func Test_EmptyAuthDomainResponseFails(t *testing.T) {
+	gqlcUsers := &graphqlClientMockPages{
+		pages: map[string]map[string]pageMock{},
+	}
+
+	us := &Users{
+		OrganizationId: "organizationId",
+		Logger:         newLoggerMock(),
+		MaxPages:       1000,
+		GqlcUsers:      gqlcUsers,
+	}
+
+	_, err := us.fetchUsers(context.Background(), []string{"domA"})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), USERS_AUTH_DOMAIN_IS_NOT_RETURNED)
+}
+
+func Test_RepeatedCursorFails(t *testing.T) {
+	gqlcUsers := &graphqlClientMockPages{
+		pages: map[string]map[string]pageMock{
+			"domA": {
+				"null": {nextCursor: cursorOf("a1"), userIds: []string{"a0"}},
+				`"a1"`: {nextCursor: cursorOf("a1"), userIds: []string{"a1"}},
+			},
+		},
+	}
+
+	us := &Users{
+		OrganizationId: "organizationId",
+		Logger:         newLoggerMock(),
+		MaxPages:       1000,
+		GqlcUsers:      gqlcUsers,
+	}
+
+	_, err := us.fetchUsers(context.Background(), []string{"domA"})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), USERS_CURSOR_IS_REPEATED)
+}
+
+func Test_MaxPagesAreExceeded(t *testing.T) {
+	gqlcUsers := &graphqlClientMockPages{
+		pages: map[string]map[string]pageMock{
+			"domA": {
+				"null": {nextCursor: cursorOf("a1"), userIds: []string{"a0"}},
+				`"a1"`: {nextCursor: cursorOf("a2"), userIds: []string{"a1"}},
+				`"a2"`: {nextCursor: nil, userIds: []string{"a2"}},
+			},
+		},
+	}
+
+	us := &Users{
+		OrganizationId: "organizationId",
+		Logger:         newLoggerMock(),
+		GqlcUsers:      gqlcUsers,
+		MaxPages:       2,
+	}
+
+	_, err := us.fetchUsers(context.Background(), []string{"domA"})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), USERS_MAX_PAGES_ARE_EXCEEDED)
+}
+
+// graphqlClientMockRaw returns the given raw response body.
+type graphqlClientMockRaw struct {
+	body string
+}
+
+func (c *graphqlClientMockRaw) Execute(
+	ctx context.Context,
+	qv any,
+	result any,
+) error {
+	err := json.Unmarshal([]byte(c.body), result)
+	if err != nil {
+		panic(err)
+	}
+	return nil
+}
+
+func Test_GraphQlErrorsWithoutDataFail(t *testing.T) {
+	logger := newLoggerMock()
+	us := &Users{
+		OrganizationId: "organizationId",
+		Logger:         logger,
+		MaxPages:       1000,
+		GqlcDomains: &graphqlClientMockRaw{
+			body: `{"data": {"actor": {"organization": null}}, "errors": [{"message": "Access denied", "path": ["actor", "organization"]}]}`,
+		},
+	}
+
+	_, err := us.fetchDomains(context.Background())
+
+	var gqlErrs gqlerror.GraphQlErrors
+	assert.True(t, errors.As(err, &gqlErrs))
+	assert.True(t, gqlErrs.IsAuthError())
+	assert.Contains(t, err.Error(), USERS_GRAPHQL_HAS_RETURNED_ERRORS)
+	assert.Contains(t, logger.msgs, USERS_GRAPHQL_HAS_RETURNED_ERRORS)
+}
+
+func Test_GraphQlErrorsWithPartialDataSucceed(t *testing.T) {
+	logger := newLoggerMock()
+	us := &Users{
+		OrganizationId: "organizationId",
+		Logger:         logger,
+		MaxPages:       1000,
+		GqlcUsers: &graphqlClientMockRaw{
+			body: `{
+				"data": {"actor": {"organization": {"userManagement": {"authenticationDomains": {
+					"authenticationDomains": [{"id": "domA", "users": {"nextCursor": null, "users": [{"id": "a0", "lastActive": null}]}}]
+				}}}}},
+				"errors": [{"message": "lastActive is not available", "path": ["actor", "organization", "userManagement", "authenticationDomains", "authenticationDomains", 0, "users", "users", 0, "lastActive"]}]
+			}`,
+		},
+	}
+
+	authDomainUsers, err := us.fetchUsers(context.Background(), []string{"domA"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(authDomainUsers))
+	assert.Contains(t, logger.msgs, USERS_GRAPHQL_HAS_RETURNED_ERRORS)
+}
+
+type eventLoggerMock struct {
+	events    []map[string]string
+	failFlush bool
+}
+
+func (l *eventLoggerMock) LogWithFields(
+	lvl logrus.Level,
+	msg string,
+	attributes map[string]string,
+) {
+	l.events = append(l.events, attributes)
+}
+
+func (l *eventLoggerMock) Flush() error {
+	if l.failFlush {
+		return errors.New("error_flush_events")
+	}
+	return nil
+}
+
+type stateStoreMock struct {
+	states map[string][]byte
+}
+
+func newStateStoreMock() *stateStoreMock {
+	return &stateStoreMock{
+		states: map[string][]byte{},
+	}
+}
+
+func (s *stateStoreMock) Load(
+	name string,
+	value any,
+) (
+	bool,
+	error,
+) {
+	bytes, ok := s.states[name]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(bytes, value)
+}
+
+func (s *stateStoreMock) Save(
+	name string,
+	value any,
+) error {
+	bytes, err := json.Marshal(value)
+	s.states[name] = bytes
+	return err
+}
+
+func Test_LifecycleChangesAreDetected(t *testing.T) {
+	previous := []authDomainUser{
+		{AuthDomainId: dom1, Id: "kept", Email: "kept@x.com", UserType: "0"},
+		{AuthDomainId: dom1, Id: "changed", Email: "old@x.com", UserType: "0"},
+		{AuthDomainId: dom1, Id: "removed", Email: "removed@x.com", UserType: "1"},
+		{AuthDomainId: dom1, Id: "mover", Email: "mover@x.com", UserType: "1"},
+	}
+	current := []authDomainUser{
+		{AuthDomainId: dom1, Id: "kept", Email: "KEPT@x.com", UserType: "0"},
+		{AuthDomainId: dom1, Id: "changed", Email: "new@x.com", UserType: "1"},
+		{AuthDomainId: dom2, Id: "moved", Email: "mover@x.com", UserType: "1"},
+		{AuthDomainId: dom2, Id: "added", Email: "added@x.com", UserType: "0"},
+	}
+
+	events := diffSnapshots(newSnapshot(previous).Users, current)
+
+	types := make([]string, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.User.Id+":"+event.Type)
+	}
+	assert.Equal(t, []string{
+		"added:" + LIFECYCLE_USER_ADDED,
+		"changed:" + LIFECYCLE_USER_EMAIL_CHANGED,
+		"changed:" + LIFECYCLE_USER_TYPE_CHANGED,
+		"moved:" + LIFECYCLE_USER_DOMAIN_MOVED,
+		"removed:" + LIFECYCLE_USER_REMOVED,
+	}, types)
+	assert.Equal(t, dom1, events[3].Previous)
+	assert.Equal(t, dom2, events[3].Current)
+}
+
+func Test_FirstRunSavesSnapshotWithoutEvents(t *testing.T) {
+	store := newStateStoreMock()
+	eventLogger := &eventLoggerMock{}
+	us := &Users{
+		OrganizationId:     "organizationId",
+		Logger:             newLoggerMock(),
+		MaxPages:           1000,
+		StateStore:         store,
+		GqlcDomains:        &graphqlClientMockDomains{},
+		GqlcDomainSettings: &graphqlClientMockDomains{},
+		GqlcUsers:          &graphqlClientMockUsers{},
+		Sink:               sink.NewNewRelic(&metricForwarderMock{}, nil, eventLogger),
+	}
+
+	err := us.Run(context.Background())
+
+	assert.Nil(t, err)
+	assert.Empty(t, eventLogger.events)
+
+	saved := &snapshot{}
+	ok, _ := store.Load(snapshotName, saved)
+	assert.True(t, ok)
+	assert.Equal(t, 4, len(saved.Users))
+}
+
+func Test_LifecycleEventsAreEmittedAgainstSnapshot(t *testing.T) {
+	store := newStateStoreMock()
+	store.Save(snapshotName, newSnapshot([]authDomainUser{
+		{AuthDomainId: dom1, Id: dom1user1, Email: dom1user1 + "@x.com", UserType: "0"},
+		{AuthDomainId: dom1, Id: "gone", Email: "gone@x.com", UserType: "0"},
+	}))
+	eventLogger := &eventLoggerMock{}
+	us := &Users{
+		OrganizationId:     "organizationId",
+		Logger:             newLoggerMock(),
+		MaxPages:           1000,
+		StateStore:         store,
+		GqlcDomains:        &graphqlClientMockDomains{},
+		GqlcDomainSettings: &graphqlClientMockDomains{},
+		GqlcUsers:          &graphqlClientMockUsers{},
+		Sink:               sink.NewNewRelic(&metricForwarderMock{}, nil, eventLogger),
+	}
+
+	err := us.Run(context.Background())
+
+	assert.Nil(t, err)
+	events := map[string]string{}
+	for _, event := range eventLogger.events {
+		events[event["tracker.users.id"]] = event["tracker.users.event"]
+	}
+	assert.Equal(t, LIFECYCLE_USER_REMOVED, events["gone"])
+	assert.Equal(t, LIFECYCLE_USER_ADDED, events[dom2user1])
+}
+
+func Test_ChangedEmailsAreRedactedAsEmails(t *testing.T) {
+	redactor, _ := redact.NewRedactor("secret", map[string]string{
+		"tracker.users.email": redact.ACTION_HASH,
+	})
+	eventLogger := &eventLoggerMock{}
+	us := &Users{
+		Logger:   newLoggerMock(),
+		MaxPages: 1000,
+		Sink:     sink.NewRedacted(sink.NewNewRelic(&metricForwarderMock{}, nil, eventLogger), redactor),
+	}
+
+	err := us.flushEvents(context.Background(), []lifecycleEvent{
+		{
+			Type:    LIFECYCLE_USER_EMAIL_CHANGED,
+			User:    authDomainUser{Id: dom1user1, Email: "new@x.com"},
+			Current: "new@x.com",
+		},
+	})
+
+	assert.Nil(t, err)
+	event := eventLogger.events[0]
+	for _, val := range event {
+		assert.NotContains(t, val, "@x.com")
+	}
+	assert.Equal(t, event["tracker.users.email"], event["tracker.users.currentEmail"])
+	assert.NotEmpty(t, event["tracker.users.currentEmail"])
+}
+
+func Test_SnapshotHoldsNoNamesOrEmails(t *testing.T) {
+	store := newStateStoreMock()
+	us := &Users{
+		OrganizationId:     "organizationId",
+		Logger:             newLoggerMock(),
+		MaxPages:           1000,
+		StateStore:         store,
+		GqlcDomains:        &graphqlClientMockDomains{},
+		GqlcDomainSettings: &graphqlClientMockDomains{},
+		GqlcUsers:          &graphqlClientMockUsers{},
+		Sink:               sink.NewNewRelic(&metricForwarderMock{}, nil, &eventLoggerMock{}),
+	}
+
+	err := us.Run(context.Background())
+
+	assert.Nil(t, err)
+	saved := string(store.states[snapshotName])
+	assert.NotContains(t, saved, "@")
+	assert.NotContains(t, saved, `"name"`)
+	assert.Contains(t, saved, hashEmail(createAuthDomainUsersMock()[dom1][dom1user1].Email))
+}
+
+func Test_SnapshotWithPlainEmailsIsCompared(t *testing.T) {
+	previous := []snapshotUser{
+		{AuthDomainId: dom1, Id: "kept", Email: "kept@x.com", UserType: "0"},
+		{AuthDomainId: dom1, Id: "mover", Email: "mover@x.com", UserType: "0"},
+	}
+	current := []authDomainUser{
+		{AuthDomainId: dom1, Id: "kept", Email: "Kept@x.com", UserType: "0"},
+		{AuthDomainId: dom2, Id: "moved", Email: "mover@x.com", UserType: "0"},
+	}
+
+	events := diffSnapshots(previous, current)
+
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, LIFECYCLE_USER_DOMAIN_MOVED, events[0].Type)
+}
+
+func Test_SnapshotIsKeptForPartialUsers(t *testing.T) {
+	store := newStateStoreMock()
+	store.Save(snapshotName, newSnapshot([]authDomainUser{
+		{AuthDomainId: dom1, Id: "gone", Email: "gone@x.com", UserType: "0"},
+	}))
+	previous := string(store.states[snapshotName])
+	logger := newLoggerMock()
+	eventLogger := &eventLoggerMock{}
+	us := &Users{
+		OrganizationId:     "organizationId",
+		Logger:             logger,
+		MaxPages:           1000,
+		StateStore:         store,
+		GqlcDomains:        &graphqlClientMockDomains{},
+		GqlcDomainSettings: &graphqlClientMockDomains{},
+		GqlcUsers: &graphqlClientMockRaw{
+			body: `{
+				"data": {"actor": {"organization": {"userManagement": {"authenticationDomains": {
+					"authenticationDomains": [{"id": "domA", "users": {"nextCursor": null, "users": [{"id": "a0"}]}}]
+				}}}}},
+				"errors": [{"message": "users are not available", "path": ["actor", "organization", "userManagement", "authenticationDomains", "authenticationDomains", 0, "users"]}]
+			}`,
+		},
+		Sink: sink.NewNewRelic(&metricForwarderMock{}, nil, eventLogger),
 	}
 
-	err := us.Run()
+	err := us.Run(context.Background())
 
 	assert.Nil(t, err)
+	assert.Empty(t, eventLogger.events)
+	assert.Contains(t, logger.msgs, USERS_SNAPSHOT_IS_SKIPPED)
+	assert.Equal(t, previous, string(store.states[snapshotName]))
+}
+
+func Test_SnapshotIsKeptIfEventsAreNotForwarded(t *testing.T) {
+	store := newStateStoreMock()
+	store.Save(snapshotName, &snapshot{})
+	us := &Users{
+		OrganizationId:     "organizationId",
+		Logger:             newLoggerMock(),
+		MaxPages:           1000,
+		StateStore:         store,
+		GqlcDomains:        &graphqlClientMockDomains{},
+		GqlcDomainSettings: &graphqlClientMockDomains{},
+		GqlcUsers:          &graphqlClientMockUsers{},
+		Sink:               sink.NewNewRelic(&metricForwarderMock{}, nil, &eventLoggerMock{failFlush: true}),
+	}
+
+	err := us.Run(context.Background())
+
+	phase, _ := tracker.GetPhase(err)
+	assert.Equal(t, tracker.PHASE_FLUSH_EVENTS, phase)
+
+	saved := &snapshot{}
+	store.Load(snapshotName, saved)
+	assert.Empty(t, saved.Users)
+}
+
+func Test_UsersAreClassifiedByActivity(t *testing.T) {
+	now := time.Date(2023, 1, 31, 12, 0, 0, 0, time.UTC)
+	classifier := newActivityClassifier(config.Inactivity{IdleDays: 30, DormantDays: 90}, now)
+
+	activity, days, ok := classifier.classify("2023-01-30T12:00:00Z")
+	assert.Equal(t, ACTIVITY_ACTIVE, activity)
+	assert.Equal(t, 1, days)
+	assert.True(t, ok)
+
+	activity, days, _ = classifier.classify("2022-12-31T12:00:00Z")
+	assert.Equal(t, ACTIVITY_IDLE, activity)
+	assert.Equal(t, 31, days)
+
+	activity, _, _ = classifier.classify(strconv.FormatInt(now.AddDate(0, 0, -120).UnixMilli(), 10))
+	assert.Equal(t, ACTIVITY_DORMANT, activity)
+
+	activity, _, ok = classifier.classify("")
+	assert.Equal(t, ACTIVITY_NEVER_LOGGED_IN, activity)
+	assert.False(t, ok)
+}
+
+func Test_ActivityMetricsAreFlushed(t *testing.T) {
+	mf := &metricForwarderMock{}
+	us := &Users{
+		OrganizationId: "organizationId",
+		Logger:         newLoggerMock(),
+		MaxPages:       1000,
+		Inactivity:     config.Inactivity{IdleDays: 30, DormantDays: 90},
+		Sink:           sink.NewNewRelic(mf, nil, nil),
+	}
+
+	err := us.flushMetrics(context.Background(), nil, []authDomainUser{
+		{Id: "active", UserType: "1", LastActive: time.Now().Format(time.RFC3339)},
+		{Id: "never", UserType: "1"},
+	}, nil)
+
+	assert.Nil(t, err)
+	counts := map[string]float64{}
+	inactiveDays := 0
+	for _, metric := range mf.metrics {
+		switch metric.name {
+		case "tracker.users.activity.count":
+			counts[metric.attributes["tracker.users.activity"]] = metric.value
+		case "tracker.users.inactiveDays":
+			inactiveDays++
+			assert.Equal(t, "active", metric.attributes["tracker.users.id"])
+		}
+	}
+	assert.Equal(t, 1, inactiveDays)
+	assert.Equal(t, map[string]float64{
+		ACTIVITY_ACTIVE:          1,
+		ACTIVITY_IDLE:            0,
+		ACTIVITY_DORMANT:         0,
+		ACTIVITY_NEVER_LOGGED_IN: 1,
+	}, counts)
+}
+
+func Test_SeatMetricsAreAggregated(t *testing.T) {
+	metrics := createSeatMetrics([]authDomainUser{
+		{AuthDomainId: dom1, UserType: "0", UserTypeName: "basic", EmailVerificationState: "VERIFIED", TimeZone: "Etc/UTC"},
+		{AuthDomainId: dom1, UserType: "1", UserTypeName: "fullPlatform", EmailVerificationState: "VERIFIED", TimeZone: "Etc/UTC"},
+		{AuthDomainId: dom2, UserType: "1", UserTypeName: "fullPlatform", EmailVerificationState: "PENDING", TimeZone: "Europe/Berlin"},
+		{AuthDomainId: dom2, UserType: "7", UserTypeName: USER_TYPE_UNKNOWN, EmailVerificationState: "VERIFIED", TimeZone: "Europe/Berlin"},
+	})
+
+	counts := map[string]float64{}
+	for _, metric := range metrics {
+		switch metric.Name {
+		case "tracker.users.type.count":
+			counts["type:"+metric.Attributes["tracker.users.typeName"]] = metric.Value
+		case "tracker.users.authDomain.count":
+			counts[metric.Attributes["tracker.users.authDomainId"]+":"+metric.Attributes["tracker.users.typeName"]] = metric.Value
+		case "tracker.users.emailVerificationState.count":
+			counts["email:"+metric.Attributes["tracker.users.emailVerificationState"]] = metric.Value
+		case "tracker.users.timeZone.count":
+			counts["tz:"+metric.Attributes["tracker.users.timeZone"]] = metric.Value
+		}
+	}
+	assert.Equal(t, map[string]float64{
+		"type:basic":        1,
+		"type:fullPlatform": 2,
+		"type:unknown":      1,
+		"dom1:basic":        1,
+		"dom1:fullPlatform": 1,
+		"dom2:fullPlatform": 1,
+		"dom2:unknown":      1,
+		"email:VERIFIED":    3,
+		"email:PENDING":     1,
+		"tz:Etc/UTC":        2,
+		"tz:Europe/Berlin":  2,
+	}, counts)
+}
+
+func Test_CounterKeysDoNotCollide(t *testing.T) {
+	c := newCounter()
+	c.add(map[string]string{"a": "1,b=2"})
+	c.add(map[string]string{"a": "1", "b": "2"})
+
+	assert.Equal(t, 2, len(c.createMetrics("count")))
+}
+
+func Test_UserTypeNamesAreResolved(t *testing.T) {
+	name, known := resolveUserTypeName("2", "Core User")
+	assert.Equal(t, "core", name)
+	assert.True(t, known)
+
+	name, known = resolveUserTypeName("9", "Observer")
+	assert.Equal(t, "Observer", name)
+	assert.False(t, known)
+
+	name, _ = resolveUserTypeName("9", "")
+	assert.Equal(t, USER_TYPE_UNKNOWN, name)
+}
+
+func Test_NonNumericUserTypeIsNotFlushedAsZero(t *testing.T) {
+	logger := newLoggerMock()
+	mf := &metricForwarderMock{}
+	us := &Users{
+		OrganizationId: "organizationId",
+		Logger:         logger,
+		MaxPages:       1000,
+		Sink:           sink.NewNewRelic(mf, nil, nil),
+	}
+
+	err := us.flushMetrics(context.Background(), nil, []authDomainUser{
+		{Id: "a", UserType: "FULL", UserTypeName: "Full platform"},
+		{Id: "b", UserType: "FULL", UserTypeName: "Full platform"},
+		{Id: "c", UserType: "1", UserTypeName: "fullPlatform"},
+	}, nil)
+
+	assert.Nil(t, err)
+	typeMetrics := 0
+	for _, metric := range mf.metrics {
+		if metric.name == "tracker.users.type" {
+			typeMetrics++
+			assert.Equal(t, "c", metric.attributes["tracker.users.id"])
+			assert.Equal(t, "fullPlatform", metric.attributes["tracker.users.typeName"])
+		}
+	}
+	assert.Equal(t, 1, typeMetrics)
+
+	reported := 0
+	for _, msg := range logger.msgs {
+		if msg == USERS_USER_TYPE_ID_IS_NOT_NUMERIC {
+			reported++
+		}
+	}
+	assert.Equal(t, 1, reported)
+}
+
+// graphqlClientMockSequence returns the given raw responses in order.
+type graphqlClientMockSequence struct {
+	bodies []string
+	qvs    []any
+}
+
+func (c *graphqlClientMockSequence) Execute(
+	ctx context.Context,
+	qv any,
+	result any,
+) error {
+	body := c.bodies[len(c.qvs)]
+	c.qvs = append(c.qvs, qv)
+	err := json.Unmarshal([]byte(body), result)
+	if err != nil {
+		panic(err)
+	}
+	return nil
+}
+
+func Test_GroupsAndRolesAreCollected(t *testing.T) {
+	gqlcGroups := &graphqlClientMockSequence{bodies: []string{`{"data": {"actor": {"organization": {"userManagement": {"authenticationDomains": {"authenticationDomains": [{"id": "domA", "groups": {"nextCursor": null, "groups": [
+		{"id": "g1", "displayName": "Admins", "users": {"nextCursor": "c1", "users": [{"id": "u1"}]}},
+		{"id": "g2", "displayName": "Readers", "users": {"nextCursor": null, "users": [{"id": "u2"}]}}
+	]}}]}}}}}}`}}
+	gqlcGroupMembers := &graphqlClientMockSequence{bodies: []string{`{"data": {"actor": {"organization": {"userManagement": {"authenticationDomains": {"authenticationDomains": [{"id": "domA", "groups": {"groups": [
+		{"id": "g1", "users": {"nextCursor": null, "users": [{"id": "u3"}]}}
+	]}}]}}}}}}`}}
+	gqlcRoles := &graphqlClientMockSequence{bodies: []string{`{"data": {"actor": {"organization": {"authorizationManagement": {"authenticationDomains": {"authenticationDomains": [{"id": "domA", "groups": {"nextCursor": null, "groups": [
+		{"id": "g1", "displayName": "Admins", "roles": {"nextCursor": "r1", "roles": [{"roleId": "1", "name": "all_product_admin", "accountId": 1, "type": "standard"}]}},
+		{"id": "g2", "displayName": "Readers", "roles": {"nextCursor": null, "roles": []}}
+	]}}]}}}}}}`}}
+	gqlcGroupRoles := &graphqlClientMockSequence{bodies: []string{`{"data": {"actor": {"organization": {"authorizationManagement": {"authenticationDomains": {"authenticationDomains": [{"id": "domA", "groups": {"groups": [
+		{"id": "g1", "roles": {"nextCursor": null, "roles": [{"roleId": "2", "name": "read_only", "accountId": 2, "type": "standard"}]}}
+	]}}]}}}}}}`}}
+
+	us := &Users{
+		OrganizationId:   "organizationId",
+		Logger:           newLoggerMock(),
+		MaxPages:         1000,
+		GqlcGroups:       gqlcGroups,
+		GqlcGroupMembers: gqlcGroupMembers,
+		GqlcRoles:        gqlcRoles,
+		GqlcGroupRoles:   gqlcGroupRoles,
+	}
+
+	groups, err := us.fetchAccess(context.Background(), []string{"domA"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(groups))
+	assert.Equal(t, []string{"u1", "u3"}, groups[0].MemberIds)
+	assert.Equal(t, 2, len(groups[0].Roles))
+	assert.Equal(t, int64(2), groups[0].Roles[1].AccountId)
+	assert.Empty(t, groups[1].Roles)
+	assert.Equal(t, `"c1"`, gqlcGroupMembers.qvs[0].(*queryVariablesGroup).Cursor)
+	assert.Equal(t, "g1", gqlcGroupRoles.qvs[0].(*queryVariablesGroup).GroupId)
+
+	users := []authDomainUser{{Id: "u1", Email: "u1@example.com"}}
+	memberships := createAccessMetrics(users, groups)
+	assert.Equal(t, 3, len(memberships))
+	assert.Equal(t, "u1@example.com", memberships[0].Attributes["tracker.users.email"])
+	assert.NotContains(t, memberships[1].Attributes, "tracker.users.email")
+
+	grants := map[string]int{}
+	for _, record := range createRoleGrantRecords(users, groups) {
+		assert.Equal(t, sink.KIND_LOG, record.Kind)
+		grants[record.Attributes["tracker.users.id"]+":"+record.Attributes["tracker.users.accountId"]]++
+	}
+	assert.Equal(t, map[string]int{"u1:1": 1, "u1:2": 1, "u3:1": 1, "u3:2": 1}, grants)
+}
+
+func Test_DomainMetricsAreCreated(t *testing.T) {
+	idleTimeoutMinutes := 30
+	metrics := createDomainMetrics([]authDomain{
+		{
+			Id:   dom1,
+			Name: "Default",
+			Settings: &authDomainSettings{
+				ProvisioningType:   "MANUAL",
+				AuthenticationType: "PASSWORD",
+				IdleTimeoutMinutes: &idleTimeoutMinutes,
+			},
+		},
+		{
+			Id:   dom2,
+			Name: "Unknown",
+		},
+	})
+
+	values := map[string]float64{}
+	for _, metric := range metrics {
+		if metric.Attributes["tracker.users.authDomainId"] != dom1 {
+			continue
+		}
+		values[metric.Name] = metric.Value
+		assert.Equal(t, "PASSWORD", metric.Attributes["tracker.users.authDomain.authenticationType"])
+		assert.NotContains(t, metric.Attributes, "tracker.users.authDomain.idleTimeoutMinutes")
+	}
+	assert.Equal(t, map[string]float64{
+		"tracker.users.authDomain.info":               1,
+		"tracker.users.authDomain.idleTimeoutMinutes": 30,
+	}, values)
+
+	// Domains without settings only have the info metric
+	assert.Equal(t, 3, len(metrics))
+	assert.Equal(t, "Unknown", metrics[2].Attributes["tracker.users.authDomainName"])
+}
+
+func Test_DomainSettingsAreDecoded(t *testing.T) {
+	us := &Users{
+		OrganizationId: "organizationId",
+		Logger:         newLoggerMock(),
+		MaxPages:       1000,
+		GqlcDomainSettings: &graphqlClientMockRaw{
+			body: `{"data": {"actor": {"organization": {"userManagement": {"authenticationDomains": {"nextCursor": null, "authenticationDomains": [
+				{
+					"id": "dom1",
+					"provisioningType": "SCIM",
+					"authenticationType": "SAML",
+					"userUpgradeSettings": {"mode": "MANAGED", "defaultUserType": "BASIC"},
+					"sessionSettings": {"idleTimeoutMinutes": 30, "sessionTimeoutMinutes": 480}
+				},
+				{
+					"id": "dom2",
+					"provisioningType": "MANUAL",
+					"authenticationType": "PASSWORD",
+					"userUpgradeSettings": {"mode": "SELF_SERVE", "defaultUserType": "CORE"},
+					"sessionSettings": {"idleTimeoutMinutes": null, "sessionTimeoutMinutes": null}
+				}
+			]}}}}}}`,
+		},
+	}
+	authDomains := []authDomain{{Id: dom1}, {Id: dom2}, {Id: "dom3"}}
+
+	us.fetchDomainSettings(context.Background(), authDomains)
+
+	idleTimeoutMinutes, sessionTimeoutMinutes := 30, 480
+	assert.Equal(t, &authDomainSettings{
+		ProvisioningType:       "SCIM",
+		AuthenticationType:     "SAML",
+		UpgradeMode:            "MANAGED",
+		UpgradeDefaultUserType: "BASIC",
+		IdleTimeoutMinutes:     &idleTimeoutMinutes,
+		SessionTimeoutMinutes:  &sessionTimeoutMinutes,
+	}, authDomains[0].Settings)
+	assert.Equal(t, &authDomainSettings{
+		ProvisioningType:       "MANUAL",
+		AuthenticationType:     "PASSWORD",
+		UpgradeMode:            "SELF_SERVE",
+		UpgradeDefaultUserType: "CORE",
+	}, authDomains[1].Settings)
+	assert.Nil(t, authDomains[2].Settings)
+
+	names := map[string]int{}
+	for _, metric := range createDomainMetrics(authDomains) {
+		names[metric.Name]++
+	}
+	assert.Equal(t, map[string]int{
+		"tracker.users.authDomain.info":                  3,
+		"tracker.users.authDomain.idleTimeoutMinutes":    1,
+		"tracker.users.authDomain.sessionTimeoutMinutes": 1,
+	}, names)
+}
+
+func Test_FailingDomainSettingsAreOnlyLogged(t *testing.T) {
+	logger := newLoggerMock()
+	mf := &metricForwarderMock{}
+	us := &Users{
+		OrganizationId:     "organizationId",
+		Logger:             logger,
+		MaxPages:           1000,
+		GqlcDomains:        &graphqlClientMockDomains{},
+		GqlcDomainSettings: &graphqlClientMockDomains{failRequest: true},
+		GqlcUsers:          &graphqlClientMockUsers{},
+		Sink:               sink.NewNewRelic(mf, nil, nil),
+	}
+
+	err := us.Run(context.Background())
+
+	assert.Nil(t, err)
+	assert.Contains(t, logger.msgs, USERS_DOMAIN_SETTINGS_COULD_NOT_BE_FETCHED)
+
+	infos := 0
+	for _, metric := range mf.metrics {
+		if metric.name == "tracker.users.authDomain.info" {
+			infos++
+			assert.NotContains(t, metric.attributes, "tracker.users.authDomain.provisioningType")
+		}
+	}
+	assert.Equal(t, 2, infos)
 }
 
 func createAuthDomainUsersMock() map[string](map[string]user.User) {
@@ -523,3 +1482,73 @@ func parseQueryVariablesUsers(
 	}
 	return qvParsed
 }
+
+func Test_ExportWritesSelectedColumnsSorted(t *testing.T) {
+	us := &Users{
+		OrganizationId:     "organizationId",
+		Logger:             newLoggerMock(),
+		MaxPages:           1000,
+		GqlcDomains:        &graphqlClientMockDomains{},
+		GqlcDomainSettings: &graphqlClientMockDomains{},
+		GqlcUsers:          &graphqlClientMockUsers{},
+	}
+
+	var buf bytes.Buffer
+	err := us.Export(context.Background(), &buf, config.Export{
+		Columns: []string{config.EXPORT_COLUMN_USER_ID, config.EXPORT_COLUMN_EMAIL, config.EXPORT_COLUMN_TYPE, config.EXPORT_COLUMN_LAST_ACTIVE},
+		SortBy:  "-" + config.EXPORT_COLUMN_USER_ID,
+		Mask:    true,
+	})
+	assert.Nil(t, err)
+
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, utf8Bom))
+	rows, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(out, utf8Bom))).ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(rows))
+	assert.Equal(t, []string{"userId", "email", "type", "lastActive"}, rows[0])
+	assert.Equal(t, []string{dom2user2, "d***", "basic", "2022-10-11T10:10:05Z"}, rows[1])
+	assert.Equal(t, []string{dom1user1, "d***", "fullPlatform", "2022-10-11T10:10:05Z"}, rows[4])
+}
+
+func Test_ExportIsRedactedByAttributes(t *testing.T) {
+	redactor, _ := redact.NewRedactor("secret", map[string]string{
+		"tracker.users.email":    redact.ACTION_HASH,
+		"tracker.users.timeZone": redact.ACTION_DROP,
+		"tracker.users.name":     redact.ACTION_MASK,
+	})
+	authDomainUsers := []authDomainUser{
+		{AuthDomainId: dom1, Id: dom1user1, Name: "John", Email: "john@x.com", TimeZone: "Europe/Berlin"},
+	}
+
+	rows := createExportRows([]authDomain{{Id: dom1, Name: "Default"}}, authDomainUsers, redactor, false)
+
+	assert.Equal(t, 1, len(rows))
+	assert.Equal(t, dom1user1, rows[0][config.EXPORT_COLUMN_USER_ID])
+	assert.Equal(t, "Default", rows[0][config.EXPORT_COLUMN_DOMAIN_NAME])
+	assert.Equal(t, "J***", rows[0][config.EXPORT_COLUMN_NAME])
+	assert.Equal(t, redactor.Apply(map[string]string{"tracker.users.email": "john@x.com"})["tracker.users.email"], rows[0][config.EXPORT_COLUMN_EMAIL])
+	assert.NotContains(t, rows[0], config.EXPORT_COLUMN_TIME_ZONE)
+}
+
+func Test_ExportEscapesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeExport(&buf, []string{config.EXPORT_COLUMN_NAME}, []map[string]string{
+		{config.EXPORT_COLUMN_NAME: "=HYPERLINK(\"x\")"},
+		{config.EXPORT_COLUMN_NAME: "John"},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, utf8Bom+"name\r\n\"'=HYPERLINK(\"\"x\"\")\"\r\nJohn\r\n", buf.String())
+}
+
+func Test_ExportRowsAreSortedNumerically(t *testing.T) {
+	rows := []map[string]string{
+		{config.EXPORT_COLUMN_USER_ID: "10"},
+		{config.EXPORT_COLUMN_USER_ID: "9"},
+	}
+
+	sortExportRows(rows, config.EXPORT_COLUMN_USER_ID)
+
+	assert.Equal(t, "9", rows[0][config.EXPORT_COLUMN_USER_ID])
+}
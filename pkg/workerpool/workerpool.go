@@ -0,0 +1,72 @@
+package workerpool
+
+import (
+	"context"
+	"sync"
+)
+
+// ForEach calls the given function for every index in [0, n) with at
+// most the given number of concurrent workers. Every index is processed
+// even if others fail and the errors are returned per index.
+func ForEach(
+	ctx context.Context,
+	workers int,
+	n int,
+	fn func(ctx context.Context, i int) error,
+) []error {
+	errs := make([]error, n)
+	if workers < 1 {
+		workers = 1
+	}
+
+	indices := make(chan int)
+	wg := new(sync.WaitGroup)
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				errs[i] = fn(ctx, i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	return errs
+}
+
+// ForEachFailFast calls the given function for every index in [0, n)
+// with at most the given number of concurrent workers. The first error
+// cancels the context of the remaining calls and is returned.
+func ForEachFailFast(
+	ctx context.Context,
+	workers int,
+	n int,
+	fn func(ctx context.Context, i int) error,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var once sync.Once
+	var firstErr error
+	ForEach(ctx, workers, n, func(ctx context.Context, i int) error {
+		// Skip the remaining indices once cancelled
+		err := ctx.Err()
+		if err == nil {
+			err = fn(ctx, i)
+		}
+		if err != nil {
+			once.Do(func() {
+				firstErr = err
+				cancel()
+			})
+		}
+		return err
+	})
+	return firstErr
+}
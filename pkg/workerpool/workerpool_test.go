@@ -0,0 +1,59 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ConcurrencyIsBounded(t *testing.T) {
+	var inFlight, maxInFlight int32
+	errs := ForEach(context.Background(), 2, 10, func(ctx context.Context, i int) error {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+
+	assert.Equal(t, 10, len(errs))
+	assert.LessOrEqual(t, maxInFlight, int32(2))
+}
+
+func Test_ErrorsAreReturnedPerIndex(t *testing.T) {
+	errs := ForEach(context.Background(), 3, 4, func(ctx context.Context, i int) error {
+		if i == 2 {
+			return errors.New("error_index")
+		}
+		return nil
+	})
+
+	assert.Nil(t, errs[0])
+	assert.Nil(t, errs[1])
+	assert.NotNil(t, errs[2])
+	assert.Nil(t, errs[3])
+}
+
+func Test_FirstErrorCancelsRemaining(t *testing.T) {
+	var calls int32
+	err := ForEachFailFast(context.Background(), 1, 10, func(ctx context.Context, i int) error {
+		atomic.AddInt32(&calls, 1)
+		if i == 1 {
+			return errors.New("error_index")
+		}
+		return nil
+	})
+
+	assert.NotNil(t, err)
+	assert.Equal(t, "error_index", err.Error())
+	assert.Equal(t, int32(2), calls)
+}